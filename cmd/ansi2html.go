@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+)
+
+// ansiConverter converts ANSI SGR sequences to the HTML that web/css/mystyle.css
+// expects. It is a port of the SGR handling of ansi2html.sh 0.26
+// (http://www.pixelbeat.org/docs/terminal_colours/) run with --body-only,
+// which the exporter used to fork for every request. Cursor movement and
+// other control sequences are stripped.
+//
+// Attributes of the input are kept across lines, so a converter has to be
+// used for a single document.
+type ansiConverter struct {
+	// spans are the attributes of the input
+	spans []string
+	// cur are the spans opened in the output
+	cur []string
+	// maxX is the widest column seen so far. Shorter lines close their spans
+	// at the end of the line.
+	maxX int
+}
+
+type ansiItemKind int
+
+const (
+	ansiText ansiItemKind = iota
+	ansiCode
+	ansiSpan
+	ansiResetAll
+	ansiClearLine
+)
+
+type ansiItem struct {
+	kind  ansiItemKind
+	value string
+}
+
+var (
+	ansiSequence  = regexp.MustCompile(`\x1b\[([0-9;?]*)([^0-9;?])`)
+	ansiTrueColor = regexp.MustCompile(`^([34])8;2;([0-9]{1,3});([0-9]{1,3});([0-9]{1,3})$`)
+	ansi256Color  = regexp.MustCompile(`^[34]8;5;[0-9]{1,3}$`)
+)
+
+// ansiToHTML converts the ANSI text to HTML to be placed in a <pre>.
+func ansiToHTML(data []byte) []byte {
+	c := &ansiConverter{maxX: 80}
+
+	lines := strings.Split(string(data), "\n")
+
+	var out bytes.Buffer
+	for idx, line := range lines {
+		items := c.parse(line)
+		// like awk, there is no record after the last newline unless
+		// something is left of it
+		if idx == len(lines)-1 && len(items) == 0 {
+			break
+		}
+		out.WriteString(c.dump(items))
+		out.WriteByte('\n')
+	}
+	return out.Bytes()
+}
+
+// parse converts a line to text and spans.
+func (c *ansiConverter) parse(line string) []ansiItem {
+	line = strings.TrimSuffix(line, "\r")
+	line = strings.ReplaceAll(line, "\a", "")
+
+	items := []ansiItem{}
+	last := 0
+	for _, loc := range ansiSequence.FindAllStringSubmatchIndex(line, -1) {
+		items = appendText(items, line[last:loc[0]])
+		last = loc[1]
+		switch {
+		case line[loc[4]:loc[5]] == "m":
+			items = append(items, sgrItems(line[loc[2]:loc[3]])...)
+		case line[loc[4]:loc[5]] == "K":
+			// the parameter tells which part of the line is erased
+			items = append(items, ansiItem{kind: ansiClearLine, value: line[loc[2]:loc[3]]})
+		}
+	}
+	items = appendText(items, line[last:])
+
+	return sgrToSpans(normalizeSGR(items))
+}
+
+// appendText appends the text with the remaining escapes stripped.
+func appendText(items []ansiItem, text string) []ansiItem {
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\x1b' {
+			i++
+			continue
+		}
+		b.WriteByte(text[i])
+	}
+	if b.Len() == 0 {
+		return items
+	}
+	return append(items, ansiItem{kind: ansiText, value: b.String()})
+}
+
+// sgrItems splits combined parameters into single codes.
+func sgrItems(params string) []ansiItem {
+	if m := ansiTrueColor.FindStringSubmatch(params); m != nil {
+		property := "color"
+		if m[1] == "4" {
+			property = "background-color"
+		}
+		return []ansiItem{{
+			kind:  ansiSpan,
+			value: `<span style="` + property + `:rgb(` + m[2] + `,` + m[3] + `,` + m[4] + `)">`,
+		}}
+	}
+	if params == "" {
+		params = "0"
+	}
+
+	items := []ansiItem{}
+	codes := strings.Split(params, ";")
+	for i := 0; i < len(codes); i++ {
+		code := codes[i]
+		if i+2 < len(codes) && ansi256Color.MatchString(strings.Join(codes[i:i+3], ";")) {
+			items = append(items, ansiItem{kind: ansiCode, value: strings.Join(codes[i:i+3], ";")})
+			i += 2
+			continue
+		}
+		if code == "" {
+			continue
+		}
+		// strip leading 0
+		if len(code) > 1 && code[0] == '0' && code[1] >= '0' && code[1] <= '7' {
+			code = code[1:]
+		}
+		items = append(items, ansiItem{kind: ansiCode, value: code})
+	}
+	return items
+}
+
+func isCode(items []ansiItem, idx int, match func(string) bool) bool {
+	return idx < len(items) && items[idx].kind == ansiCode && match(items[idx].value)
+}
+
+func isAttribute(code string) bool {
+	return len(code) == 1 && strings.ContainsAny(code, "4579")
+}
+
+func isColor(prefix byte) func(string) bool {
+	return func(code string) bool {
+		return len(code) == 2 && code[0] == prefix && code[1] >= '0' && code[1] <= '7'
+	}
+}
+
+// normalizeSGR puts bold after other attributes, maps bright colors to color
+// and bold, and marks resets.
+func normalizeSGR(items []ansiItem) []ansiItem {
+	for i := 0; i < len(items); i++ {
+		if !isCode(items, i, func(code string) bool { return code == "1" }) {
+			continue
+		}
+		j := i + 1
+		for isCode(items, j, isAttribute) {
+			j++
+		}
+		bold := items[i]
+		copy(items[i:j-1], items[i+1:j])
+		items[j-1] = bold
+		i = j - 1
+	}
+
+	normalized := []ansiItem{}
+	for _, item := range items {
+		code := item.value
+		switch {
+		case item.kind != ansiCode:
+			normalized = append(normalized, item)
+		case len(code) == 2 && code[0] == '9' && code[1] >= '0' && code[1] <= '7':
+			normalized = append(normalized,
+				ansiItem{kind: ansiCode, value: "3" + code[1:]},
+				ansiItem{kind: ansiCode, value: "1"})
+		case len(code) == 3 && code[:2] == "10" && code[2] >= '0' && code[2] <= '7':
+			normalized = append(normalized,
+				ansiItem{kind: ansiCode, value: "4" + code[2:]},
+				ansiItem{kind: ansiCode, value: "1"})
+		case code == "0":
+			normalized = append(normalized, ansiItem{kind: ansiResetAll})
+		default:
+			normalized = append(normalized, item)
+		}
+	}
+	return normalized
+}
+
+// sgrToSpans converts codes to spans, combining adjacent colors.
+func sgrToSpans(items []ansiItem) []ansiItem {
+	// a color overrides the preceding one
+	for _, prefix := range []byte{'3', '4'} {
+		merged := []ansiItem{}
+		for i := range items {
+			if isCode(items, i, isColor(prefix)) && isCode(items, i+1, isColor(prefix)) {
+				continue
+			}
+			merged = append(merged, items[i])
+		}
+		items = merged
+	}
+
+	for _, order := range [][2]byte{{'3', '4'}, {'4', '3'}} {
+		combined := []ansiItem{}
+		for i := 0; i < len(items); i++ {
+			if isCode(items, i, isColor(order[0])) && isCode(items, i+1, isColor(order[1])) {
+				fg, bg := items[i].value[1:], items[i+1].value[1:]
+				if order[0] == '4' {
+					fg, bg = bg, fg
+				}
+				combined = append(combined, ansiItem{
+					kind:  ansiSpan,
+					value: `<span class="f` + fg + ` b` + bg + `">`,
+				})
+				i++
+				continue
+			}
+			combined = append(combined, items[i])
+		}
+		items = combined
+	}
+
+	spans := []ansiItem{}
+	for _, item := range items {
+		if item.kind != ansiCode {
+			spans = append(spans, item)
+			continue
+		}
+		class := ""
+		code := item.value
+		switch {
+		case code == "1":
+			class = "bold"
+		case code == "4":
+			class = "underline"
+		case code == "5":
+			class = "blink"
+		case code == "7":
+			class = "reverse"
+		case code == "9":
+			class = "line-through"
+		case len(code) == 2 && (code[0] == '3' || code[0] == '4') && code[1] >= '0' && code[1] <= '9':
+			class = map[byte]string{'3': "f", '4': "b"}[code[0]] + code[1:]
+		case ansi256Color.MatchString(code):
+			class = map[byte]string{'3': "ef", '4': "eb"}[code[0]] + code[5:]
+		default:
+			// unhandled codes are stripped
+			continue
+		}
+		spans = append(spans, ansiItem{kind: ansiSpan, value: `<span class="` + class + `">`})
+	}
+	return spans
+}
+
+func htmlEscape(c byte) string {
+	switch c {
+	case '&':
+		return "&amp;"
+	case '"':
+		return "&quot;"
+	case '<':
+		return "&lt;"
+	case '>':
+		return "&gt;"
+	}
+	return string(c)
+}
+
+// fixSpans closes and opens spans of the output to match the attributes.
+func (c *ansiConverter) fixSpans(spans []string) string {
+	var b strings.Builder
+
+	same := 0
+	for same < len(c.cur) && same < len(spans) && c.cur[same] == spans[same] {
+		same++
+	}
+	for range c.cur[same:] {
+		b.WriteString("</span>")
+	}
+	for _, span := range spans[same:] {
+		b.WriteString(span)
+	}
+	c.cur = append(c.cur[:same:same], spans[same:]...)
+
+	return b.String()
+}
+
+// dump places the items on columns and writes the line.
+func (c *ansiConverter) dump(items []ansiItem) string {
+	cells := map[int]string{}
+	attrs := map[int][]string{}
+
+	x := 1
+	for _, item := range items {
+		switch item.kind {
+		case ansiSpan:
+			c.spans = append(c.spans, item.value)
+		case ansiResetAll:
+			c.spans = nil
+		case ansiClearLine:
+			// to the end of the line with 0, from the beginning to the
+			// cursor with 1, and all of it with 2
+			from, to := x, c.maxX
+			switch item.value {
+			case "1":
+				from, to = 1, x+1
+			case "2":
+				from = 1
+			}
+			for pos := from; pos < to; pos++ {
+				cells[pos] = " "
+				if len(c.spans) > 0 {
+					attrs[pos] = append([]string{}, c.spans...)
+				} else {
+					delete(attrs, pos)
+				}
+			}
+		case ansiText:
+			for i := 0; i < len(item.value); i++ {
+				if item.value[i] == '\r' {
+					x = 1
+					continue
+				}
+				cells[x] = htmlEscape(item.value[i])
+				if len(c.spans) > 0 {
+					attrs[x] = append([]string{}, c.spans...)
+				} else {
+					delete(attrs, x)
+				}
+				x++
+				if x > c.maxX {
+					c.maxX = x
+				}
+			}
+		}
+	}
+
+	var b strings.Builder
+	blanks := ""
+	for col := 1; col < c.maxX; col++ {
+		spans, ok := attrs[col]
+		if ok || len(c.cur) > 0 {
+			b.WriteString(blanks)
+			b.WriteString(c.fixSpans(spans))
+			blanks = ""
+		}
+		if cell, ok := cells[col]; ok {
+			b.WriteString(blanks)
+			b.WriteString(cell)
+			blanks = ""
+		} else {
+			blanks += " "
+		}
+	}
+	if len(c.cur) > 0 {
+		b.WriteString(blanks)
+	}
+	return b.String()
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// The golden files in testdata/ansi2html were generated by the
+// scripts/ansi2html --body-only that ansiToHTML replaces.
+func TestANSIToHTML(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "ansi2html", "*.ansi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatal("no golden files")
+	}
+
+	for _, input := range inputs {
+		name := strings.TrimSuffix(filepath.Base(input), ".ansi")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, err := os.ReadFile(strings.TrimSuffix(input, ".ansi") + ".html")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := ansiToHTML(data)
+			if !bytes.Equal(got, want) {
+				t.Errorf("ansiToHTML(%s) =\n%s\nwant\n%s", input, got, want)
+			}
+		})
+	}
+}
+
+func TestANSIToHTMLClearLine(t *testing.T) {
+	// the cursor is on the second column after the carriage return, and
+	// erased columns are kept as spaces up to the width of 80
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{name: "to end", input: "abcd\rx\x1b[K", want: "x" + strings.Repeat(" ", 78)},
+		{name: "to end with 0", input: "abcd\rx\x1b[0K", want: "x" + strings.Repeat(" ", 78)},
+		{name: "from beginning", input: "abcd\rx\x1b[1K", want: "  cd"},
+		{name: "whole line", input: "abcd\rx\x1b[2K", want: strings.Repeat(" ", 79)},
+		{name: "whole line then text", input: "abcd\rx\x1b[2Kyz", want: " yz" + strings.Repeat(" ", 76)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(ansiToHTML([]byte(tt.input))); got != tt.want+"\n" {
+				t.Errorf("ansiToHTML(%q) = %q, want %q", tt.input, got, tt.want+"\n")
+			}
+		})
+	}
+}
+
+func TestANSIToHTMLEmpty(t *testing.T) {
+	if got := ansiToHTML(nil); len(got) != 0 {
+		t.Errorf("ansiToHTML(nil) = %q, want empty", got)
+	}
+}
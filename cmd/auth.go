@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	authNone   = "none"
+	authBearer = "bearer"
+	authHMAC   = "hmac"
+
+	authTimestampHeader = "X-Mstat-Timestamp"
+	authNonceHeader     = "X-Mstat-Nonce"
+	authSignatureHeader = "X-Mstat-Signature"
+
+	// maxAuthSkew is how far the timestamp of a signed request may be from
+	// the clock of the exporter
+	maxAuthSkew = 5 * time.Minute
+)
+
+// Credentials authenticate the server to an exporter. With bearer, the token
+// is sent as is. With hmac, the request is signed with the token so that it
+// never goes over the wire:
+//
+//	X-Mstat-Timestamp: <unix time>
+//	X-Mstat-Nonce: <random hex>
+//	X-Mstat-Signature: hex(HMAC-SHA256(token, "<unix time>\n<nonce>\n<method>\n<path>"))
+//
+// A signed request is accepted once. Nonces are remembered until their
+// timestamp is off by more than maxAuthSkew, after which the request is
+// rejected for its timestamp anyway.
+type Credentials struct {
+	Mode  string
+	Token string
+	// nonces are the nonces of signed requests accepted, with the time they
+	// expire at
+	nonces map[string]time.Time
+	mu     *sync.Mutex
+}
+
+func NewCredentials(mode, token string) (*Credentials, error) {
+	switch mode {
+	case "", authNone:
+		return &Credentials{Mode: authNone}, nil
+	case authBearer, authHMAC:
+		if token == "" {
+			return nil, fmt.Errorf("token is required for %s authentication", mode)
+		}
+		return &Credentials{Mode: mode, Token: token, nonces: map[string]time.Time{}, mu: new(sync.Mutex)}, nil
+	}
+	return nil, fmt.Errorf("unknown authentication %s", mode)
+}
+
+func (c *Credentials) signature(timestamp, nonce, method, path string) string {
+	mac := hmac.New(sha256.New, []byte(c.Token))
+	mac.Write([]byte(timestamp + "\n" + nonce + "\n" + method + "\n" + path))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Header returns headers authenticating the request.
+func (c *Credentials) Header(method, path string) (http.Header, error) {
+	header := http.Header{}
+	switch c.Mode {
+	case authBearer:
+		header.Set("Authorization", "Bearer "+c.Token)
+	case authHMAC:
+		nonce := make([]byte, 16)
+		if _, err := rand.Read(nonce); err != nil {
+			return nil, fmt.Errorf("nonce: %w", err)
+		}
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		header.Set(authTimestampHeader, timestamp)
+		header.Set(authNonceHeader, hex.EncodeToString(nonce))
+		header.Set(authSignatureHeader, c.signature(timestamp, header.Get(authNonceHeader), method, path))
+	}
+	return header, nil
+}
+
+// use records the nonce of a signed request, and tells whether it was not
+// used before.
+func (c *Credentials) use(nonce string, expiry time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for seen, until := range c.nonces {
+		if now.After(until) {
+			delete(c.nonces, seen)
+		}
+	}
+	if _, ok := c.nonces[nonce]; ok {
+		return false
+	}
+	c.nonces[nonce] = expiry
+	return true
+}
+
+// Verify checks the headers of the request.
+func (c *Credentials) Verify(request *http.Request) error {
+	switch c.Mode {
+	case authBearer:
+		token, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+		if !ok {
+			return fmt.Errorf("no bearer token")
+		}
+		if subtle.ConstantTimeCompare([]byte(token), []byte(c.Token)) != 1 {
+			return fmt.Errorf("invalid bearer token")
+		}
+	case authHMAC:
+		timestamp := request.Header.Get(authTimestampHeader)
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid timestamp %q", timestamp)
+		}
+		if skew := time.Since(time.Unix(seconds, 0)); skew > maxAuthSkew || skew < -maxAuthSkew {
+			return fmt.Errorf("timestamp is off by %s", skew.Round(time.Second))
+		}
+		nonce := request.Header.Get(authNonceHeader)
+		if nonce == "" {
+			return fmt.Errorf("no nonce")
+		}
+		signature := c.signature(timestamp, nonce, request.Method, request.URL.Path)
+		if !hmac.Equal([]byte(request.Header.Get(authSignatureHeader)), []byte(signature)) {
+			return fmt.Errorf("invalid signature")
+		}
+		// only signed nonces are remembered, so that they cannot be flooded
+		if !c.use(nonce, time.Unix(seconds, 0).Add(maxAuthSkew)) {
+			return fmt.Errorf("replayed nonce")
+		}
+	}
+	return nil
+}
+
+// require rejects requests failing to authenticate.
+func (c *Credentials) require(next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if err := c.Verify(request); err != nil {
+			log.Warnf("Unauthenticated request to %s from %s: %s", request.URL.Path, request.RemoteAddr, err)
+			http.Error(response, "401 unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		next(response, request)
+	}
+}
+
+// readToken reads a token from the file, ignoring surrounding whitespace.
+func readToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// readMachineTokens reads tokens of machines from lines of 'machine token'.
+// A line with a token alone is the token of the other machines, so that a
+// file of a single token can be shared with exporters.
+func readMachineTokens(path string) (map[string]string, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	tokens := map[string]string{}
+	fallback := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		switch {
+		case len(fields) == 0 || strings.HasPrefix(fields[0], "#"):
+		case len(fields) == 1:
+			fallback = fields[0]
+		case len(fields) == 2:
+			tokens[fields[0]] = fields[1]
+		default:
+			return nil, "", fmt.Errorf("%s: invalid line %q", path, scanner.Text())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	return tokens, fallback, nil
+}
@@ -0,0 +1,281 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestCredentials(t *testing.T, mode, token string) *Credentials {
+	t.Helper()
+
+	c, err := NewCredentials(mode, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// authHeader is the header of the credentials for GET /ws.
+func authHeader(t *testing.T, c *Credentials) http.Header {
+	t.Helper()
+
+	header, err := c.Header("GET", "/ws")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return header
+}
+
+// signedRequest is a request to /ws signed by the credentials at the time.
+func signedRequest(c *Credentials, at time.Time, nonce string) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	request := httptest.NewRequest("GET", "/ws", nil)
+	request.Header.Set(authTimestampHeader, timestamp)
+	request.Header.Set(authNonceHeader, nonce)
+	request.Header.Set(authSignatureHeader, c.signature(timestamp, nonce, "GET", "/ws"))
+	return request
+}
+
+func TestNewCredentials(t *testing.T) {
+	tests := []struct {
+		mode    string
+		token   string
+		wantErr bool
+	}{
+		{mode: "", token: "", wantErr: false},
+		{mode: authNone, token: "secret", wantErr: false},
+		{mode: authBearer, token: "secret", wantErr: false},
+		{mode: authHMAC, token: "secret", wantErr: false},
+		{mode: authBearer, token: "", wantErr: true},
+		{mode: authHMAC, token: "", wantErr: true},
+		{mode: "basic", token: "secret", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		_, err := NewCredentials(tt.mode, tt.token)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewCredentials(%q, %q) error = %v, want error %v", tt.mode, tt.token, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCredentialsBearer(t *testing.T) {
+	exporter := newTestCredentials(t, authBearer, "secret")
+
+	tests := []struct {
+		name    string
+		header  http.Header
+		wantErr bool
+	}{
+		{name: "valid token", header: authHeader(t, newTestCredentials(t, authBearer, "secret")), wantErr: false},
+		{name: "wrong token", header: authHeader(t, newTestCredentials(t, authBearer, "guess")), wantErr: true},
+		{name: "no token", header: http.Header{}, wantErr: true},
+		{name: "basic", header: http.Header{"Authorization": {"Basic c2VjcmV0"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/ws", nil)
+			request.Header = tt.header
+			if err := exporter.Verify(request); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCredentialsHMAC(t *testing.T) {
+	server := newTestCredentials(t, authHMAC, "secret")
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		request func() *http.Request
+		wantErr bool
+	}{
+		{
+			name: "signed by header",
+			request: func() *http.Request {
+				request := httptest.NewRequest("GET", "/ws", nil)
+				request.Header = authHeader(t, server)
+				return request
+			},
+			wantErr: false,
+		},
+		{
+			name: "wrong token",
+			request: func() *http.Request {
+				return signedRequest(newTestCredentials(t, authHMAC, "guess"), now, "wrong-token")
+			},
+			wantErr: true,
+		},
+		{
+			name: "bad signature",
+			request: func() *http.Request {
+				request := signedRequest(server, now, "bad-signature")
+				request.Header.Set(authSignatureHeader, server.signature(request.Header.Get(authTimestampHeader), "other-nonce", "GET", "/ws"))
+				return request
+			},
+			wantErr: true,
+		},
+		{
+			name: "other path",
+			request: func() *http.Request {
+				request := signedRequest(server, now, "other-path")
+				request.URL.Path = "/metrics"
+				return request
+			},
+			wantErr: true,
+		},
+		{
+			name: "no nonce",
+			request: func() *http.Request {
+				request := signedRequest(server, now, "")
+				request.Header.Del(authNonceHeader)
+				return request
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid timestamp",
+			request: func() *http.Request {
+				request := signedRequest(server, now, "invalid-timestamp")
+				request.Header.Set(authTimestampHeader, "yesterday")
+				return request
+			},
+			wantErr: true,
+		},
+		{
+			name:    "just inside past skew",
+			request: func() *http.Request { return signedRequest(server, now.Add(-maxAuthSkew+5*time.Second), "inside-past") },
+			wantErr: false,
+		},
+		{
+			name:    "just inside future skew",
+			request: func() *http.Request { return signedRequest(server, now.Add(maxAuthSkew-5*time.Second), "inside-future") },
+			wantErr: false,
+		},
+		{
+			name:    "just outside past skew",
+			request: func() *http.Request { return signedRequest(server, now.Add(-maxAuthSkew-5*time.Second), "outside-past") },
+			wantErr: true,
+		},
+		{
+			name:    "just outside future skew",
+			request: func() *http.Request { return signedRequest(server, now.Add(maxAuthSkew+5*time.Second), "outside-future") },
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := newTestCredentials(t, authHMAC, "secret")
+			if err := exporter.Verify(tt.request()); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCredentialsHMACReplay(t *testing.T) {
+	server := newTestCredentials(t, authHMAC, "secret")
+	exporter := newTestCredentials(t, authHMAC, "secret")
+
+	header := authHeader(t, server)
+	for idx, wantErr := range []bool{false, true} {
+		request := httptest.NewRequest("GET", "/ws", nil)
+		request.Header = header.Clone()
+		if err := exporter.Verify(request); (err != nil) != wantErr {
+			t.Errorf("Verify() #%d error = %v, want error %v", idx+1, err, wantErr)
+		}
+	}
+
+	// a new request of the server is accepted
+	request := httptest.NewRequest("GET", "/ws", nil)
+	request.Header = authHeader(t, server)
+	if err := exporter.Verify(request); err != nil {
+		t.Errorf("Verify() of a new request: %s", err)
+	}
+}
+
+func TestCredentialsHMACNonceExpiry(t *testing.T) {
+	exporter := newTestCredentials(t, authHMAC, "secret")
+
+	// nonces past their expiry are forgotten
+	if !exporter.use("nonce", time.Now().Add(-time.Second)) {
+		t.Fatal("use() of a new nonce = false")
+	}
+	if !exporter.use("other", time.Now().Add(time.Minute)) {
+		t.Fatal("use() of a new nonce = false")
+	}
+	if _, ok := exporter.nonces["nonce"]; ok {
+		t.Error("expired nonce is remembered")
+	}
+	if exporter.use("other", time.Now().Add(time.Minute)) {
+		t.Error("use() of a used nonce = true")
+	}
+}
+
+func TestCredentialsNone(t *testing.T) {
+	c := newTestCredentials(t, authNone, "")
+	if header := authHeader(t, c); len(header) != 0 {
+		t.Errorf("Header() = %v, want none", header)
+	}
+	if err := c.Verify(httptest.NewRequest("GET", "/ws", nil)); err != nil {
+		t.Errorf("Verify() = %s", err)
+	}
+}
+
+func TestReadMachineTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	data := "# tokens of exporters\n\nmachine1:9200 token1\n  \n\tmachine2:9200\ttoken2  \n# shared\nshared-token\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tokens, fallback, err := readMachineTokens(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"machine1:9200": "token1", "machine2:9200": "token2"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("tokens = %v, want %v", tokens, want)
+	}
+	if fallback != "shared-token" {
+		t.Errorf("fallback = %q, want %q", fallback, "shared-token")
+	}
+}
+
+func TestReadMachineTokensInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens")
+	if err := os.WriteFile(path, []byte("machine1:9200 token1 extra\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readMachineTokens(path); err == nil {
+		t.Error("readMachineTokens() succeeded with an invalid line")
+	}
+
+	if _, _, err := readMachineTokens(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("readMachineTokens() succeeded with a missing file")
+	}
+}
+
+func TestReadToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(path, []byte("  secret\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	token, err := readToken(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "secret" {
+		t.Errorf("readToken() = %q, want %q", token, "secret")
+	}
+}
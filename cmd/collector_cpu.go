@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CPUStat is the CPU usage in percent since the previous sample.
+type CPUStat struct {
+	Total float64   `json:"total"`
+	Cores []float64 `json:"cores"`
+}
+
+type cpuTimes struct {
+	idle  uint64
+	total uint64
+}
+
+// CPUCollector reads /proc/stat and keeps the previous sample so that
+// usage can be computed without sleeping between two reads.
+type CPUCollector struct {
+	procPath string
+	prev     map[string]cpuTimes
+	mu       *sync.Mutex
+}
+
+func NewCPUCollector(procPath string) *CPUCollector {
+	return &CPUCollector{
+		procPath: procPath,
+		prev:     map[string]cpuTimes{},
+		mu:       new(sync.Mutex),
+	}
+}
+
+func (c *CPUCollector) Name() string {
+	return "cpu"
+}
+
+// Collect reports the CPU usage since the last call. The first call reports
+// the average usage since boot.
+func (c *CPUCollector) Collect(ctx context.Context, s *Snapshot) error {
+	times, order, err := readCPUTimes(filepath.Join(c.procPath, "stat"))
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stat := &CPUStat{}
+	for _, name := range order {
+		cur := times[name]
+		usage := cpuUsage(c.prev[name], cur)
+		if name == "cpu" {
+			stat.Total = usage
+		} else {
+			stat.Cores = append(stat.Cores, usage)
+		}
+	}
+	c.prev = times
+	s.CPU = stat
+
+	return nil
+}
+
+func cpuUsage(prev, cur cpuTimes) float64 {
+	// counters restart when a core goes offline and comes back
+	if cur.total < prev.total || cur.idle < prev.idle {
+		prev = cpuTimes{}
+	}
+	total := cur.total - prev.total
+	if total == 0 {
+		return 0
+	}
+	idle := cur.idle - prev.idle
+	return float64(total-idle) * 100 / float64(total)
+}
+
+func readCPUTimes(path string) (map[string]cpuTimes, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	times := map[string]cpuTimes{}
+	order := []string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "cpu") {
+			continue
+		}
+
+		// user nice system idle iowait irq softirq steal guest guest_nice
+		// guest and guest_nice are already accounted in user and nice
+		var t cpuTimes
+		for idx, field := range fields[1:] {
+			if idx >= 8 {
+				break
+			}
+			v, err := strconv.ParseUint(field, 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", path, err)
+			}
+			t.total += v
+			if idx == 3 || idx == 4 {
+				t.idle += v
+			}
+		}
+		times[fields[0]] = t
+		order = append(order, fields[0])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if _, ok := times["cpu"]; !ok {
+		return nil, nil, fmt.Errorf("%s: no aggregate cpu line", path)
+	}
+
+	return times, order, nil
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadCPUTimes(t *testing.T) {
+	times, order, err := readCPUTimes(filepath.Join("testdata", "proc", "stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// guest time is already in user time and is not added again
+	want := map[string]cpuTimes{
+		"cpu":  {idle: 8500, total: 10000},
+		"cpu0": {idle: 4100, total: 5000},
+		"cpu1": {idle: 4400, total: 5000},
+	}
+	if !reflect.DeepEqual(times, want) {
+		t.Errorf("times = %+v, want %+v", times, want)
+	}
+	if wantOrder := []string{"cpu", "cpu0", "cpu1"}; !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("order = %v, want %v", order, wantOrder)
+	}
+
+	for name, data := range map[string]string{
+		"no aggregate": "cpu0 1 2 3 4 5\n",
+		"invalid":      "cpu 1 2 x 4 5\n",
+	} {
+		path := filepath.Join(t.TempDir(), "stat")
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := readCPUTimes(path); err == nil {
+			t.Errorf("%s: readCPUTimes() succeeded", name)
+		}
+	}
+}
+
+func TestCPUUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		prev cpuTimes
+		cur  cpuTimes
+		want float64
+	}{
+		{name: "since boot", cur: cpuTimes{idle: 8500, total: 10000}, want: 15},
+		{name: "busy", prev: cpuTimes{idle: 8500, total: 10000}, cur: cpuTimes{idle: 8700, total: 11000}, want: 80},
+		{name: "idle", prev: cpuTimes{idle: 8500, total: 10000}, cur: cpuTimes{idle: 9500, total: 11000}, want: 0},
+		{name: "no time", prev: cpuTimes{idle: 8500, total: 10000}, cur: cpuTimes{idle: 8500, total: 10000}, want: 0},
+		// a core back online counts from zero
+		{name: "restarted", prev: cpuTimes{idle: 8500, total: 10000}, cur: cpuTimes{idle: 50, total: 100}, want: 50},
+	}
+
+	for _, tt := range tests {
+		if got := cpuUsage(tt.prev, tt.cur); got != tt.want {
+			t.Errorf("%s: cpuUsage(%+v, %+v) = %g, want %g", tt.name, tt.prev, tt.cur, got, tt.want)
+		}
+	}
+}
+
+func TestCPUCollector(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "proc", "stat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	procPath := t.TempDir()
+	write := func(data string) {
+		if err := os.WriteFile(filepath.Join(procPath, "stat"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := NewCPUCollector(procPath)
+
+	// the first sample is the usage since boot
+	write(string(fixture))
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	want := &CPUStat{Total: 15, Cores: []float64{18, 12}}
+	if !reflect.DeepEqual(s.CPU, want) {
+		t.Errorf("CPU = %+v, want %+v", s.CPU, want)
+	}
+
+	write("cpu  1600 0 700 8100 600 0 0 0 200 0\n" +
+		"cpu0 1100 0 400 3900 200 0 0 0 100 0\n" +
+		"cpu1 500 0 300 4200 400 0 0 0 100 0\n")
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	want = &CPUStat{Total: 80, Cores: []float64{100, 50}}
+	if !reflect.DeepEqual(s.CPU, want) {
+		t.Errorf("CPU = %+v, want %+v", s.CPU, want)
+	}
+}
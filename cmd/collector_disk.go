@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// pseudoFilesystems are not backed by storage and are not reported unless
+// their mount point is asked for.
+var pseudoFilesystems = map[string]bool{
+	"autofs":          true,
+	"binfmt_misc":     true,
+	"bpf":             true,
+	"cgroup":          true,
+	"cgroup2":         true,
+	"configfs":        true,
+	"debugfs":         true,
+	"devpts":          true,
+	"devtmpfs":        true,
+	"efivarfs":        true,
+	"fusectl":         true,
+	"fuse.gvfsd-fuse": true,
+	"fuse.lxcfs":      true,
+	"fuse.portal":     true,
+	"hugetlbfs":       true,
+	"mqueue":          true,
+	"nfsd":            true,
+	"nsfs":            true,
+	"overlay":         true,
+	"proc":            true,
+	"pstore":          true,
+	"ramfs":           true,
+	"rootfs":          true,
+	"rpc_pipefs":      true,
+	"securityfs":      true,
+	"selinuxfs":       true,
+	"squashfs":        true,
+	"sysfs":           true,
+	"tmpfs":           true,
+	"tracefs":         true,
+}
+
+// DiskStat is the usage of a filesystem in bytes, as reported by df(1).
+type DiskStat struct {
+	MountPoint string `json:"mount_point"`
+	Device     string `json:"device"`
+	FSType     string `json:"fs_type"`
+	Total      uint64 `json:"total"`
+	Used       uint64 `json:"used"`
+	Available  uint64 `json:"available"`
+	Inodes     uint64 `json:"inodes"`
+	InodesUsed uint64 `json:"inodes_used"`
+}
+
+// UsedPercent is the percentage of space in use. Space reserved for root is
+// not counted as available, like df(1).
+func (d *DiskStat) UsedPercent() float64 {
+	if d.Used+d.Available == 0 {
+		return 0
+	}
+	return float64(d.Used) * 100 / float64(d.Used+d.Available)
+}
+
+// InodesUsedPercent is the percentage of inodes in use.
+func (d *DiskStat) InodesUsedPercent() float64 {
+	if d.Inodes == 0 {
+		return 0
+	}
+	return float64(d.InodesUsed) * 100 / float64(d.Inodes)
+}
+
+type mount struct {
+	device     string
+	mountPoint string
+	fsType     string
+}
+
+// errStatPending is returned for a mount whose statfs(2) of a previous
+// collection has not returned yet.
+var errStatPending = errors.New("statfs of the previous collection is pending")
+
+// DiskCollector reports usage of the given mount points, or of all real
+// filesystems in mounts of a process if none is given. The mount namespace of
+// the host is seen through /proc/1/mounts with its root mounted at rootPath.
+type DiskCollector struct {
+	nsPath      string
+	rootPath    string
+	mountPoints []string
+	// pending are mount points being statted, which are not statted again
+	// until it returns, so that a hung network filesystem holds up a
+	// single goroutine
+	pending map[string]bool
+	mu      *sync.Mutex
+}
+
+func NewDiskCollector(nsPath, rootPath string, mountPoints []string) *DiskCollector {
+	return &DiskCollector{
+		nsPath:      nsPath,
+		rootPath:    rootPath,
+		mountPoints: mountPoints,
+		pending:     map[string]bool{},
+		mu:          new(sync.Mutex),
+	}
+}
+
+func (c *DiskCollector) Name() string {
+	return "disk"
+}
+
+func (c *DiskCollector) Collect(ctx context.Context, s *Snapshot) error {
+	mounts, err := readMounts(filepath.Join(c.nsPath, "mounts"))
+	if err != nil {
+		return err
+	}
+
+	targets := []mount{}
+	if len(c.mountPoints) > 0 {
+		for _, mountPoint := range c.mountPoints {
+			target := mount{device: "none", mountPoint: mountPoint, fsType: "unknown"}
+			// the last mount on the path is the visible one
+			for _, m := range mounts {
+				if m.mountPoint == filepath.Clean(mountPoint) {
+					target = m
+				}
+			}
+			targets = append(targets, target)
+		}
+	} else {
+		// bind mounts show up once per mount point. Devices of network
+		// filesystems and ZFS are not paths, e.g. host:/export or pool/data.
+		seen := map[string]bool{}
+		for _, m := range mounts {
+			if pseudoFilesystems[m.fsType] || seen[m.device] {
+				continue
+			}
+			seen[m.device] = true
+			targets = append(targets, m)
+		}
+	}
+
+	disks := []DiskStat{}
+	for _, target := range targets {
+		disk, err := c.stat(ctx, target)
+		// discovered mounts may be hidden from the exporter or hung, which
+		// is not the case for the ones asked for
+		if len(c.mountPoints) == 0 && (errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, errStatPending)) {
+			log.Debugf("Mount %s is skipped: %s", target.mountPoint, err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		disks = append(disks, disk)
+	}
+	s.Disks = disks
+
+	return nil
+}
+
+// stat returns usage of the mount under the root. statfs(2) blocks on
+// unreachable network filesystems, so it gives up when the context is done,
+// and the mount is not statted again until the blocked call returns.
+func (c *DiskCollector) stat(ctx context.Context, m mount) (DiskStat, error) {
+	c.mu.Lock()
+	if c.pending[m.mountPoint] {
+		c.mu.Unlock()
+		return DiskStat{}, fmt.Errorf("%s: %w", m.mountPoint, errStatPending)
+	}
+	c.pending[m.mountPoint] = true
+	c.mu.Unlock()
+
+	type result struct {
+		stat syscall.Statfs_t
+		err  error
+	}
+	done := make(chan result, 1)
+	go func() {
+		r := result{}
+		r.err = syscall.Statfs(filepath.Join(c.rootPath, m.mountPoint), &r.stat)
+
+		c.mu.Lock()
+		delete(c.pending, m.mountPoint)
+		c.mu.Unlock()
+		done <- r
+	}()
+
+	var r result
+	select {
+	case <-ctx.Done():
+		return DiskStat{}, fmt.Errorf("%s: %s", m.mountPoint, ctx.Err())
+	case r = <-done:
+	}
+	if r.err != nil {
+		return DiskStat{}, fmt.Errorf("%s: %w", m.mountPoint, r.err)
+	}
+
+	bsize := uint64(r.stat.Bsize)
+	disk := DiskStat{
+		MountPoint: m.mountPoint,
+		Device:     m.device,
+		FSType:     m.fsType,
+		Total:      r.stat.Blocks * bsize,
+		Used:       (r.stat.Blocks - r.stat.Bfree) * bsize,
+		Available:  r.stat.Bavail * bsize,
+		Inodes:     r.stat.Files,
+	}
+	if r.stat.Files >= r.stat.Ffree {
+		disk.InodesUsed = r.stat.Files - r.stat.Ffree
+	}
+	return disk, nil
+}
+
+// readMounts parses mounts in the format of fstab(5).
+func readMounts(path string) ([]mount, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	mounts := []mount{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%s: invalid line %q", path, scanner.Text())
+		}
+		mounts = append(mounts, mount{
+			device:     unescapeMount(fields[0]),
+			mountPoint: unescapeMount(fields[1]),
+			fsType:     fields[2],
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return mounts, nil
+}
+
+// unescapeMount decodes octal escapes of spaces, tabs, newlines and
+// backslashes in /proc/self/mounts.
+func unescapeMount(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if v, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(v))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReadMounts(t *testing.T) {
+	mounts, err := readMounts(filepath.Join("testdata", "proc", "1", "mounts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []mount{
+		{device: "/dev/sda1", mountPoint: "/", fsType: "ext4"},
+		{device: "proc", mountPoint: "/proc", fsType: "proc"},
+		{device: "tmpfs", mountPoint: "/run", fsType: "tmpfs"},
+		{device: "/dev/sdb1", mountPoint: "/mnt/my disk", fsType: "ext4"},
+		{device: "/dev/sdb1", mountPoint: "/srv/bind", fsType: "ext4"},
+		{device: "server:/export", mountPoint: "/data", fsType: "nfs4"},
+		{device: "/dev/sdc1", mountPoint: "/hidden", fsType: "xfs"},
+		{device: "tmpfs", mountPoint: "/data", fsType: "tmpfs"},
+	}
+	if !reflect.DeepEqual(mounts, want) {
+		t.Errorf("readMounts() = %+v, want %+v", mounts, want)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "mounts")
+	if err := os.WriteFile(invalid, []byte("/dev/sda1 /\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readMounts(invalid); err == nil {
+		t.Error("readMounts() succeeded with a line of two fields")
+	}
+}
+
+func TestUnescapeMount(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "/mnt/data", want: "/mnt/data"},
+		{input: `/mnt/my\040disk`, want: "/mnt/my disk"},
+		{input: `/mnt/tab\011newline\012`, want: "/mnt/tab\tnewline\n"},
+		{input: `/mnt/back\134slash`, want: `/mnt/back\slash`},
+		{input: `/mnt/short\04`, want: `/mnt/short\04`},
+		{input: `/mnt/not\999octal`, want: `/mnt/not\999octal`},
+	}
+
+	for _, tt := range tests {
+		if got := unescapeMount(tt.input); got != tt.want {
+			t.Errorf("unescapeMount(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// diskRoot makes the mount points of testdata/proc/1/mounts but /hidden
+// under a root.
+func diskRoot(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	for _, dir := range []string{"mnt/my disk", "srv/bind", "data", "var/empty"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func diskMounts(disks []DiskStat) []mount {
+	mounts := []mount{}
+	for _, disk := range disks {
+		mounts = append(mounts, mount{device: disk.Device, mountPoint: disk.MountPoint, fsType: disk.FSType})
+	}
+	return mounts
+}
+
+func TestDiskCollector(t *testing.T) {
+	nsPath := filepath.Join("testdata", "proc", "1")
+
+	tests := []struct {
+		name        string
+		mountPoints []string
+		want        []mount
+	}{
+		{
+			// pseudo filesystems, bind mounts and hidden mounts are left out
+			name: "discovered",
+			want: []mount{
+				{device: "/dev/sda1", mountPoint: "/", fsType: "ext4"},
+				{device: "/dev/sdb1", mountPoint: "/mnt/my disk", fsType: "ext4"},
+				{device: "server:/export", mountPoint: "/data", fsType: "nfs4"},
+			},
+		},
+		{
+			name:        "asked for",
+			mountPoints: []string{"/data/", "/srv/bind", "/var/empty"},
+			want: []mount{
+				{device: "tmpfs", mountPoint: "/data", fsType: "tmpfs"},
+				{device: "/dev/sdb1", mountPoint: "/srv/bind", fsType: "ext4"},
+				{device: "none", mountPoint: "/var/empty", fsType: "unknown"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewDiskCollector(nsPath, diskRoot(t), tt.mountPoints)
+			s := &Snapshot{}
+			if err := c.Collect(context.Background(), s); err != nil {
+				t.Fatal(err)
+			}
+			if got := diskMounts(s.Disks); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Collect() = %+v, want %+v", got, tt.want)
+			}
+			for _, disk := range s.Disks {
+				if disk.Total == 0 || disk.Inodes < disk.InodesUsed {
+					t.Errorf("usage of %s = %+v", disk.MountPoint, disk)
+				}
+			}
+		})
+	}
+
+	c := NewDiskCollector(nsPath, diskRoot(t), []string{"/hidden"})
+	if err := c.Collect(context.Background(), &Snapshot{}); err == nil {
+		t.Error("Collect() succeeded with a mount point asked for missing")
+	}
+}
+
+func TestDiskCollectorPending(t *testing.T) {
+	nsPath := filepath.Join("testdata", "proc", "1")
+	root := diskRoot(t)
+
+	// statfs(2) of /data of a previous collection is hung
+	c := NewDiskCollector(nsPath, root, nil)
+	c.pending["/data"] = true
+
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	want := []mount{
+		{device: "/dev/sda1", mountPoint: "/", fsType: "ext4"},
+		{device: "/dev/sdb1", mountPoint: "/mnt/my disk", fsType: "ext4"},
+	}
+	if got := diskMounts(s.Disks); !reflect.DeepEqual(got, want) {
+		t.Errorf("Collect() = %+v, want %+v", got, want)
+	}
+	if !c.pending["/data"] {
+		t.Error("pending statfs of /data is forgotten")
+	}
+
+	// a mount point asked for fails instead
+	c = NewDiskCollector(nsPath, root, []string{"/data"})
+	c.pending["/data"] = true
+	if err := c.Collect(context.Background(), &Snapshot{}); !errors.Is(err, errStatPending) {
+		t.Errorf("Collect() = %v, want %v", err, errStatPending)
+	}
+
+	// the mount is statted again once the call returns
+	delete(c.pending, "/data")
+	if err := c.Collect(context.Background(), &Snapshot{}); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.pending) != 0 {
+		t.Errorf("pending = %v after statfs returned", c.pending)
+	}
+}
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sectors in /proc/diskstats are always 512 bytes regardless of the device
+const diskSectorSize = 512
+
+// DiskIOStat is the throughput and IOPS of a block device since the previous
+// sample, along with the raw counters.
+type DiskIOStat struct {
+	Device       string  `json:"device"`
+	ReadRate     float64 `json:"read_bytes_per_second"`
+	WriteRate    float64 `json:"write_bytes_per_second"`
+	ReadIOPS     float64 `json:"reads_per_second"`
+	WriteIOPS    float64 `json:"writes_per_second"`
+	ReadBytes    uint64  `json:"read_bytes"`
+	WrittenBytes uint64  `json:"written_bytes"`
+	Reads        uint64  `json:"reads"`
+	Writes       uint64  `json:"writes"`
+}
+
+type diskCounters struct {
+	reads        uint64
+	readSectors  uint64
+	writes       uint64
+	writeSectors uint64
+}
+
+// DiskIOCollector reads /proc/diskstats and keeps the previous sample to
+// compute rates. Devices show up from the second sample on.
+type DiskIOCollector struct {
+	procPath string
+	filter   *nameFilter
+	prev     map[string]diskCounters
+	prevTime time.Time
+	mu       *sync.Mutex
+}
+
+func NewDiskIOCollector(procPath string, filter *nameFilter) *DiskIOCollector {
+	return &DiskIOCollector{
+		procPath: procPath,
+		filter:   filter,
+		prev:     map[string]diskCounters{},
+		mu:       new(sync.Mutex),
+	}
+}
+
+func (c *DiskIOCollector) Name() string {
+	return "diskio"
+}
+
+func (c *DiskIOCollector) Collect(ctx context.Context, s *Snapshot) error {
+	counters, order, err := readDiskStats(filepath.Join(c.procPath, "diskstats"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seconds := now.Sub(c.prevTime).Seconds()
+	stats := []DiskIOStat{}
+	for _, name := range order {
+		if !c.filter.match(name) {
+			continue
+		}
+		cur := counters[name]
+		prev, ok := c.prev[name]
+		if !ok {
+			continue
+		}
+		stats = append(stats, DiskIOStat{
+			Device:       name,
+			ReadRate:     counterRate(prev.readSectors, cur.readSectors, seconds) * diskSectorSize,
+			WriteRate:    counterRate(prev.writeSectors, cur.writeSectors, seconds) * diskSectorSize,
+			ReadIOPS:     counterRate(prev.reads, cur.reads, seconds),
+			WriteIOPS:    counterRate(prev.writes, cur.writes, seconds),
+			ReadBytes:    cur.readSectors * diskSectorSize,
+			WrittenBytes: cur.writeSectors * diskSectorSize,
+			Reads:        cur.reads,
+			Writes:       cur.writes,
+		})
+	}
+	c.prev = counters
+	c.prevTime = now
+	s.DiskIO = stats
+
+	return nil
+}
+
+func readDiskStats(path string) (map[string]diskCounters, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	counters := map[string]diskCounters{}
+	order := []string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// major minor name reads merged sectors ms writes merged sectors ms ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			return nil, nil, fmt.Errorf("%s: invalid line %q", path, scanner.Text())
+		}
+		values := []uint64{}
+		for _, idx := range []int{3, 5, 7, 9} {
+			v, err := strconv.ParseUint(fields[idx], 10, 64)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %s", path, err)
+			}
+			values = append(values, v)
+		}
+		counters[fields[2]] = diskCounters{
+			reads:        values[0],
+			readSectors:  values[1],
+			writes:       values[2],
+			writeSectors: values[3],
+		}
+		order = append(order, fields[2])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return counters, order, nil
+}
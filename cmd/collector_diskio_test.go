@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadDiskStats(t *testing.T) {
+	counters, order, err := readDiskStats(filepath.Join("testdata", "proc", "diskstats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrder := []string{"loop0", "sda", "sda1", "nvme0n1", "nvme0n1p1"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("order = %v, want %v", order, wantOrder)
+	}
+	want := diskCounters{reads: 1000, readSectors: 80000, writes: 2000, writeSectors: 160000}
+	if counters["sda"] != want {
+		t.Errorf("sda = %+v, want %+v", counters["sda"], want)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "diskstats")
+	if err := os.WriteFile(invalid, []byte("8 0 sda 1 2 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readDiskStats(invalid); err == nil {
+		t.Error("readDiskStats() succeeded with a short line")
+	}
+}
+
+func TestDiskIOCollector(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "proc", "diskstats"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	procPath := t.TempDir()
+	write := func(data string) {
+		if err := os.WriteFile(filepath.Join(procPath, "diskstats"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter, err := newNameFilter("", defaultDiskIOExclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewDiskIOCollector(procPath, filter)
+
+	// devices show up from the second sample on
+	write(string(fixture))
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.DiskIO) != 0 {
+		t.Errorf("DiskIO = %+v of the first sample, want none", s.DiskIO)
+	}
+
+	// sda reads 100 and writes 200 times of 10000 sectors each in 10
+	// seconds, and the counters of nvme0n1 are reset
+	next := strings.Replace(string(fixture), "sda 1000 50 80000 900 2000 100 160000", "sda 1100 50 90000 900 2200 100 170000", 1)
+	next = strings.Replace(next, "nvme0n1 300 0 24000 100 400 0 32000", "nvme0n1 3 0 240 100 4 0 320", 1)
+	write(next)
+	c.prevTime = time.Now().Add(-10 * time.Second)
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.DiskIO) != 2 || s.DiskIO[0].Device != "sda" || s.DiskIO[1].Device != "nvme0n1" {
+		t.Fatalf("DiskIO = %+v, want sda and nvme0n1", s.DiskIO)
+	}
+	sda, nvme := s.DiskIO[0], s.DiskIO[1]
+	near := func(got, want float64) bool {
+		return math.Abs(got-want) <= want/100
+	}
+	if !near(sda.ReadRate, 10000*diskSectorSize/10) || !near(sda.WriteRate, 10000*diskSectorSize/10) ||
+		!near(sda.ReadIOPS, 10) || !near(sda.WriteIOPS, 20) {
+		t.Errorf("sda = %+v, want 512000 bytes and 10 and 20 operations per second", sda)
+	}
+	if sda.ReadBytes != 90000*diskSectorSize || sda.WrittenBytes != 170000*diskSectorSize || sda.Reads != 1100 || sda.Writes != 2200 {
+		t.Errorf("sda = %+v, want the counters of the second sample", sda)
+	}
+	if nvme.ReadRate != 0 || nvme.WriteRate != 0 || nvme.ReadIOPS != 0 || nvme.WriteIOPS != 0 {
+		t.Errorf("nvme0n1 = %+v, want no rate after the reset", nvme)
+	}
+}
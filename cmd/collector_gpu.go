@@ -0,0 +1,294 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gpuQuery  = "index,uuid,name,temperature.gpu,utilization.gpu,fan.speed,power.draw,power.limit,memory.used,memory.total"
+	appsQuery = "gpu_uuid,pid,used_memory"
+)
+
+// GPUStat is the status of a GPU as reported by nvidia-smi.
+// Memory is in MiB and power is in W. Values that are not supported by the
+// GPU, such as fan speed of passively cooled GPUs, are reported as 0.
+type GPUStat struct {
+	Index       int          `json:"index"`
+	UUID        string       `json:"uuid"`
+	Name        string       `json:"name"`
+	Temperature int          `json:"temperature"`
+	Utilization int          `json:"utilization"`
+	FanSpeed    int          `json:"fan_speed"`
+	PowerDraw   float64      `json:"power_draw"`
+	PowerLimit  float64      `json:"power_limit"`
+	MemoryUsed  uint64       `json:"memory_used"`
+	MemoryTotal uint64       `json:"memory_total"`
+	Processes   []GPUProcess `json:"processes"`
+}
+
+// GPUProcess is a compute process running on a GPU. Memory is in MiB.
+type GPUProcess struct {
+	PID        int       `json:"pid"`
+	User       string    `json:"user"`
+	Group      string    `json:"group"`
+	Command    string    `json:"command"`
+	UsedMemory uint64    `json:"used_memory"`
+	Workload   *Workload `json:"workload,omitempty"`
+}
+
+// computeApp is a row of --query-compute-apps.
+type computeApp struct {
+	UUID       string
+	PID        int
+	UsedMemory uint64
+}
+
+// GPUCollector queries nvidia-smi. The binary is looked up with
+// NVIDIA_SMI_PREFIX prepended, as the scripts used to do.
+type GPUCollector struct {
+	binary    string
+	procPath  string
+	users     *UserResolver
+	workloads *WorkloadResolver
+}
+
+func NewGPUCollector(procPath string, users *UserResolver, workloads *WorkloadResolver) *GPUCollector {
+	return &GPUCollector{
+		binary:    os.Getenv("NVIDIA_SMI_PREFIX") + "nvidia-smi",
+		procPath:  procPath,
+		users:     users,
+		workloads: workloads,
+	}
+}
+
+// Available tells whether nvidia-smi is installed.
+func (c *GPUCollector) Available() bool {
+	_, err := exec.LookPath(c.binary)
+	return err == nil
+}
+
+func (c *GPUCollector) Name() string {
+	return "gpu"
+}
+
+func (c *GPUCollector) query(ctx context.Context, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, c.binary, append(args, "--format=csv,noheader,nounits")...)
+	// do not wait for children of a killed nvidia-smi holding the pipes
+	cmd.WaitDelay = time.Second
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// nvidia-smi reports driver failures on stdout
+		msg := strings.TrimSpace(stderr.String() + string(out))
+		return nil, fmt.Errorf("%s %s: %s: %s", c.binary, args[0], err, msg)
+	}
+	return out, nil
+}
+
+// Collect reports no GPU when nvidia-smi is not installed.
+func (c *GPUCollector) Collect(ctx context.Context, s *Snapshot) error {
+	if !c.Available() {
+		s.GPUs = []GPUStat{}
+		return nil
+	}
+
+	out, err := c.query(ctx, "--query-gpu="+gpuQuery)
+	if err != nil {
+		return err
+	}
+	gpus, err := parseGPUs(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+
+	out, err = c.query(ctx, "--query-compute-apps="+appsQuery)
+	if err != nil {
+		return err
+	}
+	apps, err := parseComputeApps(bytes.NewReader(out))
+	if err != nil {
+		return err
+	}
+
+	byUUID := map[string]int{}
+	for idx := range gpus {
+		byUUID[gpus[idx].UUID] = idx
+	}
+	for _, app := range apps {
+		idx, ok := byUUID[app.UUID]
+		if !ok {
+			continue
+		}
+		// already killed process
+		uid, gid, err := processOwner(c.procPath, app.PID)
+		if err != nil {
+			continue
+		}
+		command := "Unknown"
+		if args, err := processCmdline(c.procPath, app.PID); err == nil && len(args) > 0 {
+			command = strings.Join(args, " ")
+		}
+
+		gpus[idx].Processes = append(gpus[idx].Processes, GPUProcess{
+			PID:        app.PID,
+			User:       c.users.Lookup(uid),
+			Group:      c.users.LookupGroup(gid),
+			Command:    command,
+			UsedMemory: app.UsedMemory,
+			Workload:   c.workloads.Lookup(ctx, c.procPath, app.PID),
+		})
+	}
+	s.GPUs = gpus
+
+	return nil
+}
+
+// readCSV reads the output of nvidia-smi in csv,noheader,nounits format.
+func readCSV(r io.Reader, fields int) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = fields
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		for idx := range record {
+			record[idx] = strings.TrimSpace(record[idx])
+		}
+	}
+	return records, nil
+}
+
+// notSupported tells whether nvidia-smi could not report the value.
+// e.g. '[N/A]', '[Not Supported]', 'N/A'
+func notSupported(value string) bool {
+	value = strings.Trim(value, "[]")
+	return value == "N/A" || value == "Not Supported" || value == "Unknown Error"
+}
+
+// optional is 0 for values nvidia-smi could not report. Other values are
+// parsed as they are, so that a field every GPU has, such as the index or the
+// total memory, fails to parse when it is not reported.
+func optional(value string) string {
+	if notSupported(value) {
+		return "0"
+	}
+	return value
+}
+
+// csvParser keeps the first error of parsing the fields of a record.
+type csvParser struct {
+	err error
+}
+
+func (p *csvParser) int(value, name string) int {
+	if p.err != nil {
+		return 0
+	}
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return v
+}
+
+func (p *csvParser) uint(value, name string) uint64 {
+	if p.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return v
+}
+
+func (p *csvParser) float(value, name string) float64 {
+	if p.err != nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.err = fmt.Errorf("invalid %s %q", name, value)
+	}
+	return v
+}
+
+// parseGPUs parses the output of --query-gpu=gpuQuery.
+func parseGPUs(r io.Reader) ([]GPUStat, error) {
+	records, err := readCSV(r, len(strings.Split(gpuQuery, ",")))
+	if err != nil {
+		return nil, err
+	}
+
+	gpus := []GPUStat{}
+	for line, record := range records {
+		p := csvParser{}
+		gpu := GPUStat{
+			Index:       p.int(record[0], "index"),
+			UUID:        record[1],
+			Name:        record[2],
+			Temperature: p.int(optional(record[3]), "temperature"),
+			Utilization: p.int(optional(record[4]), "utilization"),
+			FanSpeed:    p.int(optional(record[5]), "fan speed"),
+			PowerDraw:   p.float(optional(record[6]), "power draw"),
+			PowerLimit:  p.float(optional(record[7]), "power limit"),
+			MemoryUsed:  p.uint(optional(record[8]), "memory used"),
+			MemoryTotal: p.uint(record[9], "memory total"),
+			Processes:   []GPUProcess{},
+		}
+		if p.err != nil {
+			return nil, fmt.Errorf("line %d: %s", line+1, p.err)
+		}
+		if gpu.UUID == "" {
+			return nil, fmt.Errorf("line %d: empty uuid", line+1)
+		}
+		gpus = append(gpus, gpu)
+	}
+	return gpus, nil
+}
+
+// parseComputeApps parses the output of --query-compute-apps=appsQuery.
+// nvidia-smi prints a message instead of rows on some versions when there is
+// no process, which is ignored.
+func parseComputeApps(r io.Reader) ([]computeApp, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte(",")) {
+		return []computeApp{}, nil
+	}
+
+	records, err := readCSV(bytes.NewReader(data), len(strings.Split(appsQuery, ",")))
+	if err != nil {
+		return nil, err
+	}
+
+	apps := []computeApp{}
+	for line, record := range records {
+		p := csvParser{}
+		app := computeApp{
+			UUID:       record[0],
+			PID:        p.int(record[1], "pid"),
+			UsedMemory: p.uint(optional(record[2]), "used memory"),
+		}
+		if p.err != nil {
+			return nil, fmt.Errorf("line %d: %s", line+1, p.err)
+		}
+		apps = append(apps, app)
+	}
+	return apps, nil
+}
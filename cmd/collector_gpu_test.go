@@ -0,0 +1,233 @@
+package cmd
+
+import (
+	"context"
+	"os/user"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// newFakeGPUCollector returns a collector running testdata/nvidia-smi/nvidia-smi
+// with the given fixture, through NVIDIA_SMI_PREFIX.
+func newFakeGPUCollector(t *testing.T, fixture string) *GPUCollector {
+	t.Helper()
+
+	dir, err := filepath.Abs(filepath.Join("testdata", "nvidia-smi"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NVIDIA_SMI_PREFIX", dir+"/")
+	t.Setenv("FAKE_NVIDIA_SMI_FIXTURE", filepath.Join(dir, fixture))
+
+	return NewGPUCollector(filepath.Join("testdata", "proc"), NewUserResolver("/", ""), NewWorkloadResolver("", nil))
+}
+
+func currentUser(t *testing.T) string {
+	t.Helper()
+
+	u, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Username
+}
+
+// fixtureGroup is the group of the process fixture, which is the one of the
+// checkout.
+func fixtureGroup(t *testing.T, pid int) string {
+	t.Helper()
+
+	_, gid, err := processOwner(filepath.Join("testdata", "proc"), pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewUserResolver("/", "").LookupGroup(gid)
+}
+
+func TestGPUCollector(t *testing.T) {
+	rtx := GPUStat{
+		Index:       0,
+		UUID:        "GPU-8a1b2c3d-0000-0000-0000-000000000000",
+		Name:        "NVIDIA GeForce RTX 3090",
+		Temperature: 65,
+		Utilization: 87,
+		FanSpeed:    30,
+		PowerDraw:   250.12,
+		PowerLimit:  350,
+		MemoryUsed:  20000,
+		MemoryTotal: 24576,
+		Processes:   []GPUProcess{},
+	}
+	a100 := GPUStat{
+		Index:       1,
+		UUID:        "GPU-8a1b2c3d-1111-1111-1111-111111111111",
+		Name:        "NVIDIA A100-SXM4-40GB",
+		Temperature: 34,
+		Utilization: 0,
+		FanSpeed:    0,
+		PowerDraw:   0,
+		PowerLimit:  400,
+		MemoryUsed:  0,
+		MemoryTotal: 40960,
+		Processes:   []GPUProcess{},
+	}
+
+	rtxBusy := rtx
+	rtxBusy.Processes = []GPUProcess{
+		{
+			PID:        4242,
+			User:       currentUser(t),
+			Group:      fixtureGroup(t, 4242),
+			Command:    "python train.py --epochs 10",
+			UsedMemory: 19999,
+		},
+	}
+
+	tests := []struct {
+		fixture string
+		want    []GPUStat
+	}{
+		{fixture: "two-gpus", want: []GPUStat{rtxBusy, a100}},
+		{fixture: "no-processes", want: []GPUStat{rtx, a100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			c := newFakeGPUCollector(t, tt.fixture)
+			if !c.Available() {
+				t.Fatalf("%s is not available", c.binary)
+			}
+
+			s := &Snapshot{}
+			if err := c.Collect(context.Background(), s); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(s.GPUs, tt.want) {
+				t.Errorf("Collect() = %+v, want %+v", s.GPUs, tt.want)
+			}
+		})
+	}
+}
+
+func TestGPUCollectorDriverFailure(t *testing.T) {
+	c := newFakeGPUCollector(t, "driver-failure")
+
+	err := c.Collect(context.Background(), &Snapshot{})
+	if err == nil {
+		t.Fatal("Collect() succeeded with a broken driver")
+	}
+	if !strings.Contains(err.Error(), "couldn't communicate with the NVIDIA driver") {
+		t.Errorf("error does not include the nvidia-smi message: %s", err)
+	}
+}
+
+func TestGPUCollectorNotInstalled(t *testing.T) {
+	t.Setenv("NVIDIA_SMI_PREFIX", filepath.Join(t.TempDir(), "missing-"))
+
+	c := NewGPUCollector("/proc", NewUserResolver("/", ""), NewWorkloadResolver("", nil))
+	if c.Available() {
+		t.Errorf("%s is available", c.binary)
+	}
+
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if s.GPUs == nil || len(s.GPUs) != 0 {
+		t.Errorf("Collect() = %+v, want no GPU", s.GPUs)
+	}
+}
+
+func TestParseGPUsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "missing field", input: "0, GPU-0, Tesla T4, 40, 0, 0, 10.0, 70.0, 0\n"},
+		{name: "not a number", input: "0, GPU-0, Tesla T4, hot, 0, 0, 10.0, 70.0, 0, 15360\n"},
+		{name: "empty uuid", input: "0, , Tesla T4, 40, 0, 0, 10.0, 70.0, 0, 15360\n"},
+		{name: "not supported index", input: "[N/A], GPU-0, Tesla T4, 40, 0, 0, 10.0, 70.0, 0, 15360\n"},
+		{name: "not supported memory total", input: "0, GPU-0, Tesla T4, 40, 0, 0, 10.0, 70.0, 0, [N/A]\n"},
+		{name: "not a float", input: "0, GPU-0, Tesla T4, 40, 0, 0, 10.0W, 70.0, 0, 15360\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseGPUs(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("parseGPUs(%q) succeeded", tt.input)
+			}
+		})
+	}
+}
+
+func TestParseGPUsNotSupported(t *testing.T) {
+	input := "0, GPU-0, Tesla T4, 40, [N/A], [Not Supported], [N/A], 70.00, 0, 15360\n"
+	want := []GPUStat{{
+		Index:       0,
+		UUID:        "GPU-0",
+		Name:        "Tesla T4",
+		Temperature: 40,
+		PowerLimit:  70,
+		MemoryTotal: 15360,
+		Processes:   []GPUProcess{},
+	}}
+
+	got, err := parseGPUs(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseGPUs(%q) = %+v, want %+v", input, got, want)
+	}
+}
+
+func TestParseComputeAppsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "not supported pid", input: "GPU-0, [N/A], 1024\n"},
+		{name: "not a number", input: "GPU-0, 12, 1024MiB\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseComputeApps(strings.NewReader(tt.input)); err == nil {
+				t.Errorf("parseComputeApps(%q) succeeded", tt.input)
+			}
+		})
+	}
+}
+
+func TestParseComputeApps(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []computeApp
+	}{
+		{name: "empty", input: "", want: []computeApp{}},
+		{name: "no process message", input: "No running processes found\n", want: []computeApp{}},
+		{
+			name:  "not supported memory",
+			input: "GPU-0, 12, [N/A]\nGPU-1, 34, 1024\n",
+			want: []computeApp{
+				{UUID: "GPU-0", PID: 12, UsedMemory: 0},
+				{UUID: "GPU-1", PID: 34, UsedMemory: 1024},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseComputeApps(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseComputeApps(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// MemoryStat is the memory usage in bytes, as reported by free(1).
+type MemoryStat struct {
+	Total     uint64 `json:"total"`
+	Used      uint64 `json:"used"`
+	BuffCache uint64 `json:"buff_cache"`
+	Available uint64 `json:"available"`
+	SwapTotal uint64 `json:"swap_total"`
+	SwapUsed  uint64 `json:"swap_used"`
+}
+
+// UsedPercent is the percentage of memory in use, excluding buffers and cache.
+func (m *MemoryStat) UsedPercent() float64 {
+	if m.Total == 0 {
+		return 0
+	}
+	return float64(m.Used) * 100 / float64(m.Total)
+}
+
+// MemoryCollector reads /proc/meminfo.
+type MemoryCollector struct {
+	procPath string
+}
+
+func NewMemoryCollector(procPath string) *MemoryCollector {
+	return &MemoryCollector{procPath: procPath}
+}
+
+func (c *MemoryCollector) Name() string {
+	return "memory"
+}
+
+func (c *MemoryCollector) Collect(ctx context.Context, s *Snapshot) error {
+	path := filepath.Join(c.procPath, "meminfo")
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		// values are in kB unless there is no unit
+		if len(fields) == 3 && fields[2] == "kB" {
+			v *= 1024
+		}
+		info[strings.TrimSuffix(fields[0], ":")] = v
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := info["MemTotal"]; !ok {
+		return fmt.Errorf("%s: MemTotal not found", path)
+	}
+
+	stat := &MemoryStat{
+		Total:     info["MemTotal"],
+		BuffCache: info["Buffers"] + info["Cached"] + info["SReclaimable"],
+		SwapTotal: info["SwapTotal"],
+	}
+
+	// kernels older than 3.14 do not report MemAvailable
+	if available, ok := info["MemAvailable"]; ok {
+		stat.Available = available
+	} else {
+		stat.Available = info["MemFree"] + stat.BuffCache
+	}
+
+	free := info["MemFree"]
+	if stat.Total >= free+stat.BuffCache {
+		stat.Used = stat.Total - free - stat.BuffCache
+	}
+	if stat.SwapTotal >= info["SwapFree"] {
+		stat.SwapUsed = stat.SwapTotal - info["SwapFree"]
+	}
+
+	s.Memory = stat
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMemoryCollector(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "proc", "meminfo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const kB = 1024
+
+	// used is total - free - buffers - cache, like free(1)
+	tests := []struct {
+		name    string
+		meminfo string
+		want    MemoryStat
+	}{
+		{
+			name:    "meminfo",
+			meminfo: string(fixture),
+			want: MemoryStat{
+				Total:     16000000 * kB,
+				Used:      8000000 * kB,
+				BuffCache: 4000000 * kB,
+				Available: 10000000 * kB,
+				SwapTotal: 2000000 * kB,
+				SwapUsed:  500000 * kB,
+			},
+		},
+		{
+			// kernels older than 3.14 have no MemAvailable
+			name:    "no MemAvailable",
+			meminfo: strings.Replace(string(fixture), "MemAvailable:   10000000 kB\n", "", 1),
+			want: MemoryStat{
+				Total:     16000000 * kB,
+				Used:      8000000 * kB,
+				BuffCache: 4000000 * kB,
+				Available: 8000000 * kB,
+				SwapTotal: 2000000 * kB,
+				SwapUsed:  500000 * kB,
+			},
+		},
+		{
+			name:    "no swap",
+			meminfo: "MemTotal: 1000 kB\nMemFree: 100 kB\nMemAvailable: 500 kB\nCached: 300 kB\nSwapTotal: 0 kB\nSwapFree: 0 kB\n",
+			want: MemoryStat{
+				Total:     1000 * kB,
+				Used:      600 * kB,
+				BuffCache: 300 * kB,
+				Available: 500 * kB,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			procPath := t.TempDir()
+			if err := os.WriteFile(filepath.Join(procPath, "meminfo"), []byte(tt.meminfo), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			s := &Snapshot{}
+			if err := NewMemoryCollector(procPath).Collect(context.Background(), s); err != nil {
+				t.Fatal(err)
+			}
+			if *s.Memory != tt.want {
+				t.Errorf("Memory = %+v, want %+v", *s.Memory, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryCollectorFixture(t *testing.T) {
+	s := &Snapshot{}
+	if err := NewMemoryCollector(filepath.Join("testdata", "proc")).Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Memory.UsedPercent(); got != 50 {
+		t.Errorf("UsedPercent() = %g, want 50", got)
+	}
+}
+
+func TestMemoryCollectorInvalid(t *testing.T) {
+	for name, meminfo := range map[string]string{
+		"no MemTotal":   "MemFree: 100 kB\n",
+		"invalid value": "MemTotal: many kB\n",
+	} {
+		procPath := t.TempDir()
+		if err := os.WriteFile(filepath.Join(procPath, "meminfo"), []byte(meminfo), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := NewMemoryCollector(procPath).Collect(context.Background(), &Snapshot{}); err == nil {
+			t.Errorf("%s: Collect() succeeded", name)
+		}
+	}
+}
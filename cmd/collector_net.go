@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NetworkStat is the throughput of an interface in bytes per second since the
+// previous sample, along with the raw counters.
+type NetworkStat struct {
+	Interface string  `json:"interface"`
+	RxRate    float64 `json:"rx_bytes_per_second"`
+	TxRate    float64 `json:"tx_bytes_per_second"`
+	RxBytes   uint64  `json:"rx_bytes"`
+	TxBytes   uint64  `json:"tx_bytes"`
+}
+
+type netCounters struct {
+	rx uint64
+	tx uint64
+}
+
+// NetworkCollector reads net/dev of a process, /proc/self/net/dev for the
+// network namespace of the exporter or /proc/1/net/dev for the one of the
+// host. It keeps the previous sample to compute rates, so interfaces show up
+// from the second sample on.
+type NetworkCollector struct {
+	nsPath   string
+	filter   *nameFilter
+	prev     map[string]netCounters
+	prevTime time.Time
+	mu       *sync.Mutex
+}
+
+func NewNetworkCollector(nsPath string, filter *nameFilter) *NetworkCollector {
+	return &NetworkCollector{
+		nsPath: nsPath,
+		filter: filter,
+		prev:   map[string]netCounters{},
+		mu:     new(sync.Mutex),
+	}
+}
+
+func (c *NetworkCollector) Name() string {
+	return "network"
+}
+
+func (c *NetworkCollector) Collect(ctx context.Context, s *Snapshot) error {
+	counters, order, err := readNetDev(filepath.Join(c.nsPath, "net", "dev"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	seconds := now.Sub(c.prevTime).Seconds()
+	stats := []NetworkStat{}
+	for _, name := range order {
+		if !c.filter.match(name) {
+			continue
+		}
+		cur := counters[name]
+		prev, ok := c.prev[name]
+		if !ok {
+			continue
+		}
+		stats = append(stats, NetworkStat{
+			Interface: name,
+			RxRate:    counterRate(prev.rx, cur.rx, seconds),
+			TxRate:    counterRate(prev.tx, cur.tx, seconds),
+			RxBytes:   cur.rx,
+			TxBytes:   cur.tx,
+		})
+	}
+	c.prev = counters
+	c.prevTime = now
+	s.Network = stats
+
+	return nil
+}
+
+func readNetDev(path string) (map[string]netCounters, []string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	counters := map[string]netCounters{}
+	order := []string{}
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// the first two lines are headers
+		name, values, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		name = strings.TrimSpace(name)
+
+		// rx: bytes packets errs drop fifo frame compressed multicast
+		// tx: bytes packets errs drop fifo colls carrier compressed
+		fields := strings.Fields(values)
+		if len(fields) < 16 {
+			return nil, nil, fmt.Errorf("%s: invalid line of %s", path, name)
+		}
+		rx, err := strconv.ParseUint(fields[0], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", path, err)
+		}
+		tx, err := strconv.ParseUint(fields[8], 10, 64)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %s", path, err)
+		}
+		counters[name] = netCounters{rx: rx, tx: tx}
+		order = append(order, name)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return counters, order, nil
+}
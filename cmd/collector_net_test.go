@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadNetDev(t *testing.T) {
+	counters, order, err := readNetDev(filepath.Join("testdata", "proc", "1", "net", "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantOrder := []string{"lo", "eth0", "docker0", "ib0"}
+	if !reflect.DeepEqual(order, wantOrder) {
+		t.Errorf("order = %v, want %v", order, wantOrder)
+	}
+	want := map[string]netCounters{
+		"lo":      {rx: 123456, tx: 123456},
+		"eth0":    {rx: 1000000, tx: 500000},
+		"docker0": {rx: 0, tx: 1000},
+		"ib0":     {rx: math.MaxUint64, tx: 42},
+	}
+	if !reflect.DeepEqual(counters, want) {
+		t.Errorf("counters = %+v, want %+v", counters, want)
+	}
+
+	invalid := filepath.Join(t.TempDir(), "dev")
+	if err := os.WriteFile(invalid, []byte("  eth0: 1 2 3\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readNetDev(invalid); err == nil {
+		t.Error("readNetDev() succeeded with a short line")
+	}
+}
+
+func TestNetworkCollector(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "proc", "1", "net", "dev"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nsPath := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(nsPath, "net"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	write := func(data string) {
+		if err := os.WriteFile(filepath.Join(nsPath, "net", "dev"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	filter, err := newNameFilter("", defaultNetExclude)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewNetworkCollector(nsPath, filter)
+
+	// interfaces show up from the second sample on
+	write(string(fixture))
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Network) != 0 {
+		t.Errorf("Network = %+v of the first sample, want none", s.Network)
+	}
+
+	// eth0 receives 1 MB and transmits 0.5 MB in 10 seconds, and the
+	// counter of ib0 wraps around
+	next := strings.Replace(string(fixture), "1000000    2000", "2000000    3000", 1)
+	next = strings.Replace(next, "500000    1500", "1000000    2500", 1)
+	next = strings.Replace(next, "18446744073709551615 1", "100 2", 1)
+	write(next)
+	c.prevTime = time.Now().Add(-10 * time.Second)
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Network) != 2 || s.Network[0].Interface != "eth0" || s.Network[1].Interface != "ib0" {
+		t.Fatalf("Network = %+v, want eth0 and ib0", s.Network)
+	}
+	eth0, ib0 := s.Network[0], s.Network[1]
+	if math.Abs(eth0.RxRate-100000) > 1000 || math.Abs(eth0.TxRate-50000) > 500 {
+		t.Errorf("eth0 = %+v, want 100000 and 50000 bytes per second", eth0)
+	}
+	if eth0.RxBytes != 2000000 || eth0.TxBytes != 1000000 {
+		t.Errorf("eth0 = %+v, want the counters of the second sample", eth0)
+	}
+	if ib0.RxRate != 0 || ib0.TxRate != 0 || ib0.RxBytes != 100 {
+		t.Errorf("ib0 = %+v, want no rate after the wrap around", ib0)
+	}
+}
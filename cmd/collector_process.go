@@ -0,0 +1,272 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// clockTicks is USER_HZ, the unit of times in /proc/[pid]/stat. It is 100 on
+// all architectures Linux supports.
+const clockTicks = 100
+
+// ProcessStat is a process with its CPU usage in percent of a core since the
+// previous sample and its resident memory in bytes.
+type ProcessStat struct {
+	PID     int     `json:"pid"`
+	User    string  `json:"user"`
+	Group   string  `json:"group"`
+	Command string  `json:"command"`
+	CPU     float64 `json:"cpu"`
+	RSS     uint64  `json:"rss"`
+	Elapsed uint64  `json:"elapsed_seconds"`
+
+	Workload *Workload `json:"workload,omitempty"`
+}
+
+// UserStat is the usage of all processes of a user. CPU is in percent of a
+// core and GPUMemory is in MiB like GPUStat.
+type UserStat struct {
+	User      string  `json:"user"`
+	Processes int     `json:"processes"`
+	CPU       float64 `json:"cpu"`
+	RSS       uint64  `json:"rss"`
+	GPUs      int     `json:"gpus"`
+	GPUMemory uint64  `json:"gpu_memory"`
+}
+
+type processTimes struct {
+	pid   int
+	comm  string
+	ticks uint64
+	start uint64
+	rss   uint64
+}
+
+// ProcessCollector reports processes using the most CPU and memory and the
+// usage of each user. It keeps the previous sample so that CPU usage is
+// measured between two calls, while new processes report their average usage
+// since they started, like ps(1).
+//
+// GPU usage of users is taken from the GPUs in the snapshot, which are the ones
+// of the previous collection as collectors run concurrently.
+type ProcessCollector struct {
+	procPath  string
+	users     *UserResolver
+	workloads *WorkloadResolver
+	top       int
+	prev      map[int]processTimes
+	prevTime  time.Time
+	mu        *sync.Mutex
+}
+
+func NewProcessCollector(procPath string, users *UserResolver, workloads *WorkloadResolver, top int) *ProcessCollector {
+	return &ProcessCollector{
+		procPath:  procPath,
+		users:     users,
+		workloads: workloads,
+		top:       top,
+		prev:      map[int]processTimes{},
+		mu:        new(sync.Mutex),
+	}
+}
+
+func (c *ProcessCollector) Name() string {
+	return "process"
+}
+
+func (c *ProcessCollector) Collect(ctx context.Context, s *Snapshot) error {
+	uptime, err := readUptime(filepath.Join(c.procPath, "uptime"))
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(c.procPath)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := map[int]processTimes{}
+	stats := []ProcessStat{}
+	users := map[string]*UserStat{}
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		// processes may exit while walking /proc
+		times, err := readProcessTimes(c.procPath, pid)
+		if err != nil {
+			continue
+		}
+		current[pid] = times
+
+		startSeconds := float64(times.start) / clockTicks
+		elapsed := uptime - startSeconds
+		ticks := times.ticks
+		prev, ok := c.prev[pid]
+		if ok && prev.start == times.start && prev.ticks <= times.ticks {
+			ticks -= prev.ticks
+			elapsed = now.Sub(c.prevTime).Seconds()
+		}
+
+		stat := ProcessStat{
+			PID: pid,
+			RSS: times.rss * uint64(os.Getpagesize()),
+		}
+		if elapsed > 0 {
+			stat.CPU = float64(ticks) / clockTicks * 100 / elapsed
+		}
+		if uptime > startSeconds {
+			stat.Elapsed = uint64(uptime - startSeconds)
+		}
+		stats = append(stats, stat)
+
+		name := anonymousUser
+		if uid, _, err := processOwner(c.procPath, pid); err == nil {
+			name = c.users.Lookup(uid)
+		}
+		user := userStat(users, name)
+		user.Processes++
+		user.CPU += stat.CPU
+		user.RSS += stat.RSS
+	}
+
+	for _, gpu := range s.GPUs {
+		seen := map[string]bool{}
+		for _, p := range gpu.Processes {
+			user := userStat(users, p.User)
+			user.GPUMemory += p.UsedMemory
+			if !seen[p.User] {
+				seen[p.User] = true
+				user.GPUs++
+			}
+		}
+	}
+	c.prev = current
+	c.prevTime = now
+
+	byCPU := append([]ProcessStat{}, stats...)
+	sort.SliceStable(byCPU, func(i, j int) bool { return byCPU[i].CPU > byCPU[j].CPU })
+	byRSS := append([]ProcessStat{}, stats...)
+	sort.SliceStable(byRSS, func(i, j int) bool { return byRSS[i].RSS > byRSS[j].RSS })
+
+	s.TopCPU = c.describe(ctx, byCPU, current)
+	s.TopMemory = c.describe(ctx, byRSS, current)
+
+	s.Users = []UserStat{}
+	for _, user := range users {
+		s.Users = append(s.Users, *user)
+	}
+	sort.Slice(s.Users, func(i, j int) bool {
+		a, b := s.Users[i], s.Users[j]
+		if a.GPUMemory != b.GPUMemory {
+			return a.GPUMemory > b.GPUMemory
+		}
+		if a.CPU != b.CPU {
+			return a.CPU > b.CPU
+		}
+		return a.User < b.User
+	})
+
+	return nil
+}
+
+func userStat(users map[string]*UserStat, name string) *UserStat {
+	user, ok := users[name]
+	if !ok {
+		user = &UserStat{User: name}
+		users[name] = user
+	}
+	return user
+}
+
+// describe fills user, group, command and workload of the first processes.
+func (c *ProcessCollector) describe(ctx context.Context, stats []ProcessStat, times map[int]processTimes) []ProcessStat {
+	if len(stats) > c.top {
+		stats = stats[:c.top]
+	}
+	for idx := range stats {
+		p := &stats[idx]
+		p.User = anonymousUser
+		if uid, gid, err := processOwner(c.procPath, p.PID); err == nil {
+			p.User = c.users.Lookup(uid)
+			p.Group = c.users.LookupGroup(gid)
+		}
+		args, _ := processCmdline(c.procPath, p.PID)
+		if len(args) > 0 {
+			p.Command = strings.Join(args, " ")
+		} else {
+			// kernel threads have no arguments
+			p.Command = "[" + times[p.PID].comm + "]"
+		}
+		p.Workload = c.workloads.Lookup(ctx, c.procPath, p.PID)
+	}
+	return stats
+}
+
+func readUptime(path string) (float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 1 {
+		return 0, fmt.Errorf("%s: empty", path)
+	}
+	uptime, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %s", path, err)
+	}
+	return uptime, nil
+}
+
+func readProcessTimes(procPath string, pid int) (processTimes, error) {
+	path := filepath.Join(procPath, strconv.Itoa(pid), "stat")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return processTimes{}, err
+	}
+
+	// comm may contain spaces and parentheses
+	line := string(data)
+	open := strings.IndexByte(line, '(')
+	end := strings.LastIndexByte(line, ')')
+	if open < 0 || end < open {
+		return processTimes{}, fmt.Errorf("%s: invalid format", path)
+	}
+
+	// fields start from state, the third field of proc(5)
+	fields := strings.Fields(line[end+1:])
+	if len(fields) < 22 {
+		return processTimes{}, fmt.Errorf("%s: invalid format", path)
+	}
+	values := map[int]uint64{}
+	for _, idx := range []int{14, 15, 22, 24} {
+		v, err := strconv.ParseUint(fields[idx-3], 10, 64)
+		if err != nil {
+			return processTimes{}, fmt.Errorf("%s: %s", path, err)
+		}
+		values[idx] = v
+	}
+
+	return processTimes{
+		pid:   pid,
+		comm:  line[open+1 : end],
+		ticks: values[14] + values[15],
+		start: values[22],
+		rss:   values[24],
+	}, nil
+}
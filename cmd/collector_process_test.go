@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func TestReadProcessTimes(t *testing.T) {
+	procPath := filepath.Join("testdata", "proc")
+
+	tests := []struct {
+		pid  int
+		want processTimes
+	}{
+		{pid: 100, want: processTimes{pid: 100, comm: "python", ticks: 6000, start: 50000, rss: 1000}},
+		// comm may contain spaces and parentheses
+		{pid: 200, want: processTimes{pid: 200, comm: "my (odd) proc", ticks: 1000, start: 90000, rss: 5000}},
+		{pid: 300, want: processTimes{pid: 300, comm: "kworker/0:1", ticks: 50, start: 10, rss: 0}},
+	}
+	for _, tt := range tests {
+		got, err := readProcessTimes(procPath, tt.pid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("readProcessTimes(%d) = %+v, want %+v", tt.pid, got, tt.want)
+		}
+	}
+
+	// processes may exit while walking /proc
+	if _, err := readProcessTimes(procPath, 4242); err == nil {
+		t.Error("readProcessTimes() succeeded without stat")
+	}
+
+	invalid := t.TempDir()
+	for pid, stat := range map[int]string{
+		1: "1 no comm S 0 0",
+		2: "2 (short) S 0 0 0",
+		3: "3 (invalid) S 1 3 3 0 -1 0 0 0 0 0 x 0 0 0 20 0 1 0 10 0 0",
+	} {
+		dir := filepath.Join(invalid, strconv.Itoa(pid))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "stat"), []byte(stat), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readProcessTimes(invalid, pid); err == nil {
+			t.Errorf("readProcessTimes() succeeded with %q", stat)
+		}
+	}
+}
+
+func processPIDs(stats []ProcessStat) []int {
+	pids := []int{}
+	for _, stat := range stats {
+		pids = append(pids, stat.PID)
+	}
+	return pids
+}
+
+func TestProcessCollector(t *testing.T) {
+	procPath := filepath.Join("testdata", "proc")
+
+	tests := []struct {
+		top       int
+		topCPU    []int
+		topMemory []int
+	}{
+		{top: 0, topCPU: []int{}, topMemory: []int{}},
+		{top: 1, topCPU: []int{100}, topMemory: []int{200}},
+		{top: 2, topCPU: []int{100, 200}, topMemory: []int{200, 100}},
+		{top: 5, topCPU: []int{100, 200, 300}, topMemory: []int{200, 100, 300}},
+	}
+
+	for _, tt := range tests {
+		c := NewProcessCollector(procPath, NewUserResolver("/", ""), NewWorkloadResolver("", nil), tt.top)
+		s := &Snapshot{}
+		if err := c.Collect(context.Background(), s); err != nil {
+			t.Fatal(err)
+		}
+		if got := processPIDs(s.TopCPU); !reflect.DeepEqual(got, tt.topCPU) {
+			t.Errorf("top %d: TopCPU = %v, want %v", tt.top, got, tt.topCPU)
+		}
+		if got := processPIDs(s.TopMemory); !reflect.DeepEqual(got, tt.topMemory) {
+			t.Errorf("top %d: TopMemory = %v, want %v", tt.top, got, tt.topMemory)
+		}
+	}
+
+	// the first sample is the average usage since the processes started
+	c := NewProcessCollector(procPath, NewUserResolver("/", ""), NewWorkloadResolver("", nil), 3)
+	s := &Snapshot{}
+	if err := c.Collect(context.Background(), s); err != nil {
+		t.Fatal(err)
+	}
+	user := currentUser(t)
+	pageSize := uint64(os.Getpagesize())
+	want := []ProcessStat{
+		{PID: 100, User: user, Command: "python", CPU: 12, RSS: 1000 * pageSize, Elapsed: 500},
+		{PID: 200, User: user, Command: "/usr/local/bin/odd", CPU: 10, RSS: 5000 * pageSize, Elapsed: 100},
+	}
+	for idx, p := range want {
+		got := s.TopCPU[idx]
+		got.Group = ""
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("TopCPU[%d] = %+v, want %+v", idx, got, p)
+		}
+	}
+	// kernel threads have no arguments
+	if kthread := s.TopCPU[2]; kthread.Command != "[kworker/0:1]" || kthread.CPU <= 0 || kthread.CPU >= 0.1 {
+		t.Errorf("TopCPU[2] = %+v, want the kernel thread", kthread)
+	}
+
+	if len(s.Users) != 1 || s.Users[0].User != user || s.Users[0].Processes != 3 || s.Users[0].RSS != 6000*pageSize {
+		t.Errorf("Users = %+v, want the processes of %s", s.Users, user)
+	}
+}
@@ -0,0 +1,131 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// dockerMinRefresh limits listing containers on lookups of unknown IDs,
+	// which are usually containers of other runtimes
+	dockerMinRefresh = 5 * time.Second
+	// dockerMaxAge is how long containers are cached, so that renamed and
+	// removed containers are noticed
+	dockerMaxAge = time.Minute
+)
+
+type dockerContainer struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	Image  string            `json:"Image"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// DockerClient looks up containers through the Docker Engine API on a unix
+// socket. Containers are listed at once and cached, and the list is
+// refreshed when an unknown container shows up or the cache gets old.
+type DockerClient struct {
+	client     *http.Client
+	containers map[string]dockerContainer
+	refreshed  time.Time
+	minRefresh time.Duration
+	mu         *sync.Mutex
+}
+
+func NewDockerClient(socket string) *DockerClient {
+	return &DockerClient{
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var dialer net.Dialer
+					return dialer.DialContext(ctx, "unix", socket)
+				},
+			},
+			Timeout: 5 * time.Second,
+		},
+		containers: map[string]dockerContainer{},
+		minRefresh: dockerMinRefresh,
+		mu:         new(sync.Mutex),
+	}
+}
+
+// lookup returns the container of the full ID.
+func (c *DockerClient) lookup(ctx context.Context, id string) (dockerContainer, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	container, ok := c.containers[id]
+	age := time.Since(c.refreshed)
+	if (ok && age < dockerMaxAge) || (!ok && age < c.minRefresh) {
+		return container, ok, nil
+	}
+
+	containers, err := c.list(ctx)
+	if err != nil {
+		// keep answering from the cache while the daemon is unavailable
+		c.refreshed = time.Now()
+		return container, ok, err
+	}
+	c.containers = containers
+	c.refreshed = time.Now()
+
+	container, ok = c.containers[id]
+	return container, ok, nil
+}
+
+func (c *DockerClient) list(ctx context.Context) (map[string]dockerContainer, error) {
+	// the host is ignored when dialing the socket
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://docker/containers/json?all=1", nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker: listing containers: %s", response.Status)
+	}
+
+	list := []dockerContainer{}
+	if err := json.NewDecoder(response.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("docker: listing containers: %s", err)
+	}
+
+	containers := map[string]dockerContainer{}
+	for _, container := range list {
+		containers[container.ID] = container
+	}
+	return containers, nil
+}
+
+// describe adds the name, image and labels of the container to the workload.
+// Pods of Kubernetes running on Docker are named from the labels of kubelet.
+func (c *DockerClient) describe(ctx context.Context, w *Workload) {
+	container, ok, err := c.lookup(ctx, w.ContainerID)
+	if err != nil {
+		log.Debugf("Unable to look up container %s: %s", shortID(w.ContainerID, 12), err)
+	}
+	if !ok {
+		return
+	}
+
+	w.Runtime = "docker"
+	if len(container.Names) > 0 {
+		w.ContainerName = strings.TrimPrefix(container.Names[0], "/")
+	}
+	w.Image = container.Image
+	w.Labels = container.Labels
+	if w.PodName == "" && container.Labels["io.kubernetes.pod.name"] != "" {
+		w.PodName = container.Labels["io.kubernetes.pod.name"]
+		w.PodNamespace = container.Labels["io.kubernetes.pod.namespace"]
+	}
+}
@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	trainID   = "1111111111111111111111111111111111111111111111111111111111111111"
+	jupyterID = "2222222222222222222222222222222222222222222222222222222222222222"
+)
+
+// fakeDocker stands in for the Docker Engine API on a unix socket.
+type fakeDocker struct {
+	containers []dockerContainer
+	lists      int
+	mu         sync.Mutex
+}
+
+func (d *fakeDocker) set(containers ...dockerContainer) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.containers = containers
+}
+
+func (d *fakeDocker) listed() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lists
+}
+
+func (d *fakeDocker) ServeHTTP(response http.ResponseWriter, request *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if request.URL.Path != "/containers/json" || request.URL.Query().Get("all") != "1" {
+		http.NotFound(response, request)
+		return
+	}
+	d.lists++
+	json.NewEncoder(response).Encode(d.containers)
+}
+
+// newFakeDocker serves the fake on a socket in a temporary directory and
+// returns a client for it.
+func newFakeDocker(t *testing.T) (*fakeDocker, *DockerClient) {
+	t.Helper()
+
+	// paths of unix sockets are limited to about 100 bytes
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skipf("unix sockets are not available: %s", err)
+	}
+
+	fake := &fakeDocker{containers: []dockerContainer{}}
+	server := httptest.NewUnstartedServer(fake)
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+
+	return fake, NewDockerClient(socket)
+}
+
+func TestDockerDescribe(t *testing.T) {
+	fake, client := newFakeDocker(t)
+	fake.set(
+		dockerContainer{
+			ID:     trainID,
+			Names:  []string{"/train"},
+			Image:  "pytorch/pytorch:latest",
+			Labels: map[string]string{"team": "vision"},
+		},
+		dockerContainer{
+			ID:    jupyterID,
+			Names: []string{"/k8s_notebook_jupyter-0_lab_0a1b"},
+			Image: "jupyter/base-notebook",
+			Labels: map[string]string{
+				"io.kubernetes.pod.name":      "jupyter-0",
+				"io.kubernetes.pod.namespace": "lab",
+			},
+		},
+	)
+
+	tests := []struct {
+		name string
+		id   string
+		want Workload
+	}{
+		{
+			name: "container",
+			id:   trainID,
+			want: Workload{
+				Runtime:       "docker",
+				ContainerID:   trainID,
+				ContainerName: "train",
+				Image:         "pytorch/pytorch:latest",
+				Labels:        map[string]string{"team": "vision"},
+			},
+		},
+		{
+			name: "kubernetes pod",
+			id:   jupyterID,
+			want: Workload{
+				Runtime:       "docker",
+				ContainerID:   jupyterID,
+				ContainerName: "k8s_notebook_jupyter-0_lab_0a1b",
+				Image:         "jupyter/base-notebook",
+				Labels: map[string]string{
+					"io.kubernetes.pod.name":      "jupyter-0",
+					"io.kubernetes.pod.namespace": "lab",
+				},
+				PodName:      "jupyter-0",
+				PodNamespace: "lab",
+			},
+		},
+		{
+			name: "unknown",
+			id:   strings.Repeat("3", 64),
+			want: Workload{ContainerID: strings.Repeat("3", 64)},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &Workload{ContainerID: tt.id}
+			client.describe(context.Background(), w)
+			if !reflect.DeepEqual(*w, tt.want) {
+				t.Errorf("describe() = %+v, want %+v", *w, tt.want)
+			}
+		})
+	}
+
+	if lists := fake.listed(); lists != 1 {
+		t.Errorf("containers are listed %d times, want once", lists)
+	}
+}
+
+func TestDockerRefresh(t *testing.T) {
+	fake, client := newFakeDocker(t)
+	client.minRefresh = 0
+
+	ctx := context.Background()
+	if _, ok, err := client.lookup(ctx, trainID); err != nil || ok {
+		t.Fatalf("lookup() = %t, %v before the container is created", ok, err)
+	}
+
+	fake.set(dockerContainer{ID: trainID, Names: []string{"/train"}})
+	container, ok, err := client.lookup(ctx, trainID)
+	if err != nil || !ok {
+		t.Fatalf("lookup() = %t, %v after the container is created", ok, err)
+	}
+	if container.Names[0] != "/train" {
+		t.Errorf("name = %s, want /train", container.Names[0])
+	}
+
+	// known containers are answered from the cache
+	fake.set()
+	if _, ok, _ := client.lookup(ctx, trainID); !ok {
+		t.Errorf("lookup() of a cached container failed")
+	}
+	if lists := fake.listed(); lists != 2 {
+		t.Errorf("containers are listed %d times, want 2", lists)
+	}
+}
+
+func TestDockerUnavailable(t *testing.T) {
+	client := NewDockerClient(filepath.Join(t.TempDir(), "missing.sock"))
+
+	w := &Workload{ContainerID: trainID}
+	client.describe(context.Background(), w)
+	if !reflect.DeepEqual(*w, Workload{ContainerID: trainID}) {
+		t.Errorf("describe() = %+v without the daemon", *w)
+	}
+}
@@ -1,30 +1,32 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
-	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
 	fqdn "github.com/Showmax/go-fqdn"
+	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
-type Cache struct {
-	Data []byte
-	Time time.Time
-}
+const (
+	// loopback and virtual interfaces of containers and bridges
+	defaultNetExclude = `^(lo|ifb.*|veth.*|docker.*|br-.*|cali.*|cni.*|flannel.*|virbr.*)$`
+	// partitions and virtual devices, as whole disks already count them
+	defaultDiskIOExclude = `^((loop|ram|zram|sr)\d+|(sd|vd|xvd|hd)[a-z]+\d+|(nvme\d+n|mmcblk)\d+p\d+)$`
+)
 
 var (
-	cache = Cache{
-		Time: time.Now(),
-	}
+	// store is where outputs read snapshots from
+	store = NewStore()
 
 	exporterCmd = &cobra.Command{
 		Use:    "exporter",
@@ -43,10 +45,18 @@ func exporterWSHandler(response http.ResponseWriter, request *http.Request) {
 	ws, err := upgrader.Upgrade(response, request, nil)
 	if err != nil {
 		log.Error(err)
+		return
 	}
 	// Make sure we close the connection when the function returns
 	defer ws.Close()
 
+	serveFetch(ws)
+}
+
+// serveFetch answers fetch requests of the server with the latest status
+// until the connection breaks, or pushes statuses from then on once the
+// server subscribes.
+func serveFetch(ws *websocket.Conn) {
 	for {
 		mt, message, err := ws.ReadMessage()
 		if err != nil {
@@ -55,8 +65,16 @@ func exporterWSHandler(response http.ResponseWriter, request *http.Request) {
 		}
 		log.Debugf("Received message from server: %s\n", message)
 
-		out, err := ansi2html(cache.Data)
-		err = ws.WriteMessage(mt, out)
+		if string(message) == "subscribe" {
+			serveStream(ws)
+			return
+		}
+
+		var html []byte
+		if frame := store.Latest(); frame != nil {
+			html = frame.HTML
+		}
+		err = ws.WriteMessage(mt, html)
 		if err != nil {
 			log.Warn("Write to server is failed: ", err)
 			break
@@ -77,28 +95,41 @@ func homeConnections(response http.ResponseWriter, request *http.Request) {
 			return
 		}
 		log.Infof("Get reqeust: \n")
-		response.Write(cache.Data)
+		if frame := store.Latest(); frame != nil {
+			response.Write(frame.Data)
+		}
 	default:
 		log.Warnf("%s is not suppored", request.Method)
 	}
 }
 
-func ansi2html(data []byte) ([]byte, error) {
-	cmd := exec.Command("bash", "-c", "./scripts/ansi2html --body-only")
+func snapshotHandler(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "405 method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
 
-	stdin, err := cmd.StdinPipe()
-	if err != nil {
-		log.Error(err)
+	frame := store.Latest()
+	if frame == nil {
+		http.Error(response, "503 snapshot is not ready.", http.StatusServiceUnavailable)
+		return
 	}
-	defer stdin.Close()
 
-	go func() {
-		defer stdin.Close()
-		io.WriteString(stdin, string(data))
-	}()
+	response.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(response).Encode(frame.Snapshot); err != nil {
+		log.Warn("Write snapshot is failed: ", err)
+	}
+}
+
+func (o *MetricsOptions) metricsHandler(response http.ResponseWriter, request *http.Request) {
+	frame := store.Latest()
+	if frame == nil {
+		http.Error(response, "503 snapshot is not ready.", http.StatusServiceUnavailable)
+		return
+	}
 
-	out, err := cmd.Output()
-	return out, err
+	response.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(response, frame.Snapshot, o)
 }
 
 func init() {
@@ -109,11 +140,43 @@ func init() {
 	exporterCmd.Flags().Int("port", 9200, "port to serve")
 	exporterCmd.Flags().String("mapping", "", "mapping between username and UID")
 	exporterCmd.Flags().BoolP("show-user", "u", false, "show user name")
+	exporterCmd.Flags().Bool("show-group", false, "show group name along with user name")
 	exporterCmd.Flags().BoolP("show-pid", "p", false, "show PID")
 	exporterCmd.Flags().BoolP("show-power", "w", false, "show power usage")
 	exporterCmd.Flags().BoolP("show-cmd", "c", false, "show command of the process")
 	exporterCmd.Flags().BoolP("show-full-cmd", "f", false, "show full command of the process")
 	exporterCmd.Flags().BoolP("show-fan", "F", false, "show fan speed")
+	exporterCmd.Flags().StringSlice("mounts", []string{}, "mount points to report disk usage of (default all real filesystems)")
+	exporterCmd.Flags().String("net-include", "", "regular expression of network interfaces to report")
+	exporterCmd.Flags().String("net-exclude", defaultNetExclude, "regular expression of network interfaces not to report")
+	exporterCmd.Flags().String("diskio-include", "", "regular expression of block devices to report I/O of")
+	exporterCmd.Flags().String("diskio-exclude", defaultDiskIOExclude, "regular expression of block devices not to report I/O of")
+	exporterCmd.Flags().Bool("show-workload", false, "show container, pod or systemd unit of GPU processes")
+	exporterCmd.Flags().String("host-root", "/", "path the root of the host is mounted at, e.g. /host")
+	exporterCmd.Flags().String("pod-log-path", "/var/log/pods", "pod log directory of kubelet to name pods from, under the host root")
+	exporterCmd.Flags().String("docker-socket", "/var/run/docker.sock", "Docker socket to name containers from, under the host root")
+	exporterCmd.Flags().Bool("show-users", false, "show resource usage of each user")
+	exporterCmd.Flags().Int("top", 0, "number of processes using the most CPU and memory to show")
+	exporterCmd.Flags().Duration("interval", time.Second, "interval between collections")
+	exporterCmd.Flags().Duration("timeout", 10*time.Second, "timeout of a single collector")
+	exporterCmd.Flags().String("upstream", "", "server to connect to as an agent, e.g. wss://server.example.com/agent")
+	exporterCmd.Flags().String("token", "", "token to present to the upstream server")
+	exporterCmd.Flags().String("name", fqdn.Get(), "name to register under at the upstream server")
+	exporterCmd.Flags().String("upstream-ca", "", "CA bundle to verify the upstream server with instead of the system roots")
+	exporterCmd.Flags().String("upstream-cert", "", "client certificate to present to the upstream server")
+	exporterCmd.Flags().String("upstream-key", "", "key of --upstream-cert")
+	exporterCmd.Flags().String("auth", authNone, "authentication required from the server, one of none, bearer and hmac")
+	exporterCmd.Flags().String("auth-token", "", "token the server should present or sign requests with")
+	exporterCmd.Flags().String("auth-token-file", "", "file to read --auth-token from")
+	exporterCmd.Flags().String("tls-cert", "", "certificate to serve TLS with")
+	exporterCmd.Flags().String("tls-key", "", "key of --tls-cert")
+	exporterCmd.Flags().String("tls-client-ca", "", "CA bundle to require and verify client certificates with")
+	exporterCmd.Flags().Duration("live-max-age", 5*time.Minute, "age of the last snapshot /healthz fails at")
+	exporterCmd.Flags().Duration("ready-max-age", time.Minute, "age of the last success of any collector /readyz fails at")
+	exporterCmd.Flags().Duration("history-length", 10*time.Minute, "how long snapshots are kept for /api/v1/history")
+	exporterCmd.Flags().Duration("history-resolution", 5*time.Second, "minimum interval between snapshots kept for /api/v1/history")
+	exporterCmd.Flags().Bool("metrics-process-user", true, "label GPU memory of processes with user name in /metrics")
+	exporterCmd.Flags().Bool("metrics-process-pid", false, "label GPU memory of processes with PID in /metrics")
 	viper.BindPFlags(exporterCmd.Flags())
 
 	replacer := strings.NewReplacer("-", "_")
@@ -122,58 +185,145 @@ func init() {
 
 func exporterRun(cmd *cobra.Command, args []string) {
 
-	gpustatArgs := ""
-	for _, key := range viper.AllKeys() {
-		if key == "port" || key == "mapping" {
-			continue
-		}
-		if viper.GetBool(key) {
-			gpustatArgs += "--" + key + " "
-		}
+	renderOptions := RenderOptions{
+		ShowUser:     viper.GetBool("show-user"),
+		ShowGroup:    viper.GetBool("show-group"),
+		ShowPID:     viper.GetBool("show-pid"),
+		ShowPower:    viper.GetBool("show-power"),
+		ShowCmd:      viper.GetBool("show-cmd"),
+		ShowFullCmd:  viper.GetBool("show-full-cmd"),
+		ShowFan:      viper.GetBool("show-fan"),
+		ShowUsers:    viper.GetBool("show-users"),
+		ShowWorkload: viper.GetBool("show-workload"),
 	}
 
-	if viper.GetString("mapping") != "" {
-		mappings := strings.Split(strings.TrimSpace(viper.GetString("mapping")), " ")
+	metricsOptions := MetricsOptions{
+		ProcessUser: viper.GetBool("metrics-process-user"),
+		ProcessPID:  viper.GetBool("metrics-process-pid"),
+	}
 
-		f, err := os.Create("./mapping.txt")
-		if err != nil {
-			log.Fatal(err)
-		}
-		defer f.Close()
+	if rootOptions.Debug {
+		log.SetLevel(logrus.DebugLevel)
+	}
+
+	// the exporter sees its own namespaces through /proc/self, and the ones of
+	// the host through /proc/1 with --pid=host
+	hostRoot := viper.GetString("host-root")
+	procPath := filepath.Join(hostRoot, "proc")
+	nsPath := filepath.Join(procPath, "self")
+	if filepath.Clean(hostRoot) != "/" {
+		nsPath = filepath.Join(procPath, "1")
+		log.Infof("Reading the host at %s", hostRoot)
+	}
 
-		for i := 0; i < len(mappings); i++ {
-			mapping := strings.Split(mappings[i], ":")
+	users := NewUserResolver(hostRoot, viper.GetString("mapping"))
 
-			fmt.Println(strings.Join(mapping, ":"))
-			f.WriteString(strings.Join(mapping, ":") + "\n")
+	netFilter, err := newNameFilter(viper.GetString("net-include"), viper.GetString("net-exclude"))
+	if err != nil {
+		log.Fatal("network: ", err)
+	}
+	diskIOFilter, err := newNameFilter(viper.GetString("diskio-include"), viper.GetString("diskio-exclude"))
+	if err != nil {
+		log.Fatal("disk I/O: ", err)
+	}
+
+	var docker *DockerClient
+	if socket := viper.GetString("docker-socket"); socket != "" {
+		socket = filepath.Join(hostRoot, socket)
+		if _, err := os.Stat(socket); err == nil {
+			log.Infof("Naming containers through %s", socket)
+			docker = NewDockerClient(socket)
 		}
 	}
+	podLogPath := viper.GetString("pod-log-path")
+	if podLogPath != "" {
+		podLogPath = filepath.Join(hostRoot, podLogPath)
+	}
+	workloads := NewWorkloadResolver(podLogPath, docker)
 
-	if rootOptions.Debug {
-		log.SetLevel(logrus.DebugLevel)
+	collectors := []Collector{
+		NewCPUCollector(procPath),
+		NewMemoryCollector(procPath),
+		NewDiskCollector(nsPath, hostRoot, viper.GetStringSlice("mounts")),
+		NewNetworkCollector(nsPath, netFilter),
+		NewDiskIOCollector(procPath, diskIOFilter),
+		NewGPUCollector(procPath, users, workloads),
+	}
+	// walking all processes is not worth it when nothing of them is shown
+	if top := viper.GetInt("top"); top > 0 || renderOptions.ShowUsers {
+		collectors = append(collectors, NewProcessCollector(procPath, users, workloads, top))
+	}
+
+	authToken := viper.GetString("auth-token")
+	if path := viper.GetString("auth-token-file"); path != "" {
+		if authToken, err = readToken(path); err != nil {
+			log.Fatal("auth token: ", err)
+		}
+	}
+	credentials, err := NewCredentials(viper.GetString("auth"), authToken)
+	if err != nil {
+		log.Fatal("auth: ", err)
+	}
+	if credentials.Mode != authNone {
+		log.Infof("Requiring %s authentication", credentials.Mode)
 	}
 
-	go func(cache *Cache) {
-		for {
-			cmd := exec.Command("./scripts/sys-usage", gpustatArgs)
-			var out bytes.Buffer
-			cmd.Stdout = &out
-			err := cmd.Run()
-			if err != nil {
-				log.Fatal(err)
-			}
-			cache.Time = time.Now()
-			cache.Data = out.Bytes()
-			log.Debugf("Cache update (%s)", cache.Time.String())
+	healthOptions := NewHealthOptions(viper.GetDuration("live-max-age"), viper.GetDuration("ready-max-age"))
+	history := NewHistory(viper.GetDuration("history-length"), viper.GetDuration("history-resolution"))
+
+	scheduler := NewScheduler(viper.GetDuration("interval"), viper.GetDuration("timeout"), collectors...)
+	go scheduler.Run(context.Background(), func(snapshot *Snapshot) {
+		data := renderANSI(snapshot, &renderOptions)
+		frame := store.Publish(snapshot, data, ansiToHTML(data))
+		history.Add(snapshot)
+		log.Debugf("Snapshot %d is published (%s)", frame.Seq, snapshot.Time.String())
+	})
+
+	if upstream := viper.GetString("upstream"); upstream != "" {
+		tlsConfig, err := upstreamTLSConfig(viper.GetString("upstream-ca"), viper.GetString("upstream-cert"), viper.GetString("upstream-key"))
+		if err != nil {
+			log.Fatal("upstream TLS: ", err)
+		}
+		if tlsConfig != nil && !strings.HasPrefix(upstream, "wss://") {
+			log.Fatal("--upstream-ca, --upstream-cert and --upstream-key require a wss:// upstream")
 		}
-	}(&cache)
+		go agentLoop(upstream, viper.GetString("name"), viper.GetString("token"), tlsConfig)
+	}
 
-	http.HandleFunc("/", homeConnections)
-	http.HandleFunc("/ws", exporterWSHandler)
+	http.HandleFunc("/", credentials.require(homeConnections))
+	http.HandleFunc("/ws", credentials.require(exporterWSHandler))
+	http.HandleFunc("/api/v1/snapshot", credentials.require(snapshotHandler))
+	http.HandleFunc("/api/v1/history", credentials.require(history.historyHandler))
+	http.HandleFunc("/metrics", credentials.require(metricsOptions.metricsHandler))
+	// probes of kubelet cannot authenticate, and tell nothing but the state of collectors
+	http.HandleFunc("/healthz", healthOptions.healthzHandler)
+	http.HandleFunc("/readyz", healthOptions.readyzHandler)
 
 	log.Infof("Serving server on %s with port %d\n", fqdn.Get(), viper.GetInt("port"))
-	err := http.ListenAndServe(":"+viper.GetString("port"), nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
+	addr := ":" + viper.GetString("port")
+	if crt, key := viper.GetString("tls-cert"), viper.GetString("tls-key"); crt != "" || key != "" {
+		tlsConfig, err := exporterTLSConfig(viper.GetString("tls-client-ca"))
+		if err != nil {
+			log.Fatal("TLS client CA: ", err)
+		}
+		if tlsConfig.ClientCAs != nil {
+			log.Info("Requiring client certificates")
+		}
+		s := &http.Server{
+			Addr:      addr,
+			TLSConfig: tlsConfig,
+		}
+		err = s.ListenAndServeTLS(crt, key)
+		if err != nil {
+			log.Fatal("ListenAndServe: ", err)
+		}
+	} else {
+		if viper.GetString("tls-client-ca") != "" {
+			log.Fatal("--tls-client-ca requires --tls-cert and --tls-key")
+		}
+		err = http.ListenAndServe(addr, nil)
+		if err != nil {
+			log.Fatal("ListenAndServe: ", err)
+		}
 	}
 }
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+const maxAgentBackoff = time.Minute
+
+// agentLoop keeps a connection to the upstream server open for machines the
+// server cannot dial, and answers fetch requests over it like /ws does. The
+// TLS config is used for wss:// upstreams, and may be nil for the defaults.
+func agentLoop(upstream, name, token string, tlsConfig *tls.Config) {
+	header := http.Header{}
+	header.Set(agentMachineHeader, name)
+	header.Set("Authorization", "Bearer "+token)
+
+	dialer := dial
+	dialer.TLSClientConfig = tlsConfig
+
+	backoff := time.Second
+	for {
+		ws, response, err := dialer.Dial(upstream, header)
+		if err != nil {
+			if response != nil {
+				log.Errorf("Connect to upstream %s failed: %s (%s)", upstream, err, response.Status)
+			} else {
+				log.Errorf("Connect to upstream %s failed: %s", upstream, err)
+			}
+		} else {
+			log.Infof("Connected to upstream %s as %s", upstream, name)
+			backoff = time.Second
+			serveFetch(ws)
+			_ = ws.Close()
+			log.Warnf("Disconnected from upstream %s", upstream)
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxAgentBackoff {
+			backoff = maxAgentBackoff
+		}
+	}
+}
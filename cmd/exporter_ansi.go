@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+const (
+	ansiReset   = "\033[0m"
+	ansiResetFg = "\033[0;39m"
+	ansiBold    = "\033[1m"
+	ansiDark    = "\033[2m"
+	ansiRed     = "\033[31m"
+	ansiGreen   = "\033[32m"
+	ansiYellow  = "\033[33m"
+	ansiBlue    = "\033[34m"
+	ansiPurple  = "\033[35m"
+	ansiCyan    = "\033[36m"
+	ansiRedI    = "\033[91m"
+	ansiGreenI  = "\033[92m"
+	ansiYellowI = "\033[93m"
+	ansiCyanI   = "\033[96m"
+
+	barWidth   = 40
+	dateFormat = "Mon Jan _2 15:04:05 MST 2006"
+	gpuIndent  = "        "
+)
+
+// RenderOptions selects what is shown in the ANSI view.
+type RenderOptions struct {
+	ShowUser     bool
+	ShowGroup    bool
+	ShowPID      bool
+	ShowPower    bool
+	ShowCmd      bool
+	ShowFullCmd  bool
+	ShowFan      bool
+	ShowUsers    bool
+	ShowWorkload bool
+}
+
+// showUser tells whether user name is shown. It is shown by default unless
+// PID or command is requested.
+func (o *RenderOptions) showUser() bool {
+	return o.ShowUser || !(o.ShowPID || o.ShowCmd || o.ShowFullCmd)
+}
+
+// owner is the user name, followed by the group name with --show-group like
+// chown(1) used to take.
+// e.g. alice.research
+func (o *RenderOptions) owner(user, group string) string {
+	if o.ShowGroup && group != "" {
+		return user + "." + group
+	}
+	return user
+}
+
+func (o *RenderOptions) showCmd() bool {
+	return o.ShowCmd || o.ShowFullCmd
+}
+
+// asciiBar draws a bar figure of the percentage.
+// e.g.
+//
+//	[||||                ] 17.73 %
+func asciiBar(percent float64, width int) string {
+	var b strings.Builder
+
+	color := ansiGreenI
+	emphasis := ansiGreenI
+	if percent >= 75 {
+		color = ansiRedI
+		emphasis = ansiBold + ansiRedI
+	} else if percent >= 50 {
+		color = ansiYellowI
+		emphasis = ansiBold + ansiYellowI
+	}
+
+	b.WriteString("[")
+	b.WriteString(color)
+	for i := 0; i < width; i++ {
+		if float64(i)/float64(width) < percent/100.0 {
+			b.WriteString("|")
+		} else {
+			b.WriteString(" ")
+		}
+	}
+	b.WriteString(ansiResetFg)
+	b.WriteString("] ")
+	b.WriteString(emphasis)
+	fmt.Fprintf(&b, "%6.2f", percent)
+	b.WriteString(ansiResetFg)
+	b.WriteString(" %")
+
+	return b.String()
+}
+
+// renderANSI renders the snapshot as ANSI text in the style of gpustat.
+func renderANSI(s *Snapshot, o *RenderOptions) []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "%s%s%s   %s\n", ansiBold, s.Host, ansiReset, s.Time.Format(dateFormat))
+	for _, status := range s.FailingCollectors() {
+		fmt.Fprintf(&out, "   ERR: %s%s: %s%s (failed %d times, last success: %s)\n",
+			ansiRed, status.Name, status.LastError, ansiResetFg, status.Failures, lastSuccess(&status))
+	}
+
+	cpu := "N/A"
+	if s.CPU != nil {
+		cpu = asciiBar(s.CPU.Total, barWidth)
+	}
+	mem := "N/A"
+	if s.Memory != nil {
+		mem = asciiBar(s.Memory.UsedPercent(), barWidth)
+	}
+	fmt.Fprintf(&out, "   CPU: %s\n", cpu)
+	fmt.Fprintf(&out, "   MEM: %s", mem)
+	for _, disk := range s.Disks {
+		fmt.Fprintf(&out, "\n  DISK: %s %s%s%s (%s / %s, inodes %.0f %%)",
+			asciiBar(disk.UsedPercent(), barWidth), ansiBold, disk.MountPoint, ansiReset,
+			humanBytes(disk.Used), humanBytes(disk.Total), disk.InodesUsedPercent())
+	}
+	for _, network := range s.Network {
+		fmt.Fprintf(&out, "\n   NET: %s%s%s rx %s%s/s%s tx %s%s/s%s",
+			ansiBold, network.Interface, ansiReset,
+			ansiGreen, humanBytes(uint64(network.RxRate)), ansiResetFg,
+			ansiCyan, humanBytes(uint64(network.TxRate)), ansiResetFg)
+	}
+	for _, io := range s.DiskIO {
+		fmt.Fprintf(&out, "\n    IO: %s%s%s read %s%s/s%s (%.0f IOPS) write %s%s/s%s (%.0f IOPS)",
+			ansiBold, io.Device, ansiReset,
+			ansiGreen, humanBytes(uint64(io.ReadRate)), ansiResetFg, io.ReadIOPS,
+			ansiCyan, humanBytes(uint64(io.WriteRate)), ansiResetFg, io.WriteIOPS)
+	}
+
+	if len(s.GPUs) > 0 {
+		fmt.Fprintf(&out, "\n   GPU: %s\n", asciiBar(s.GPUUtilization(), barWidth))
+		for _, line := range renderGPUs(s.GPUs, o) {
+			out.WriteString(gpuIndent + line + "\n")
+		}
+	}
+
+	for _, top := range []struct {
+		title     string
+		processes []ProcessStat
+	}{
+		{title: "TOP CPU", processes: s.TopCPU},
+		{title: "TOP MEM", processes: s.TopMemory},
+	} {
+		if len(top.processes) == 0 {
+			continue
+		}
+		if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "   %s%s:%s\n", ansiBold, top.title, ansiReset)
+		for _, p := range top.processes {
+			out.WriteString(gpuIndent + renderTopProcess(&p, o) + "\n")
+		}
+	}
+
+	if o.ShowUsers && len(s.Users) > 0 {
+		if !bytes.HasSuffix(out.Bytes(), []byte("\n")) {
+			out.WriteString("\n")
+		}
+		fmt.Fprintf(&out, "   %sUSERS:%s\n", ansiBold, ansiReset)
+		for _, line := range renderUsers(s.Users) {
+			out.WriteString(gpuIndent + line + "\n")
+		}
+	}
+
+	return out.Bytes()
+}
+
+// humanBytes formats the size with a binary prefix like df -h.
+// e.g. 1.5G
+func humanBytes(size uint64) string {
+	value := float64(size)
+	for _, unit := range []string{"B", "K", "M", "G", "T", "P"} {
+		if value < 1024 || unit == "P" {
+			if unit == "B" {
+				return fmt.Sprintf("%.0f%s", value, unit)
+			}
+			return fmt.Sprintf("%.1f%s", value, unit)
+		}
+		value /= 1024
+	}
+	return ""
+}
+
+func lastSuccess(status *CollectorStatus) string {
+	if status.LastSuccess.IsZero() {
+		return "never"
+	}
+	return status.LastSuccess.Format(dateFormat)
+}
+
+func renderGPUs(gpus []GPUStat, o *RenderOptions) []string {
+	indexWidth := len(strconv.Itoa(len(gpus)))
+	nameWidth := 0
+	for _, gpu := range gpus {
+		if len(gpu.Name) > nameWidth {
+			nameWidth = len(gpu.Name)
+		}
+	}
+
+	lines := []string{}
+	for _, gpu := range gpus {
+		var b strings.Builder
+
+		fmt.Fprintf(&b, "%s[%*d] %s", ansiCyan, indexWidth, gpu.Index, ansiResetFg)
+		fmt.Fprintf(&b, "%s%-*s%s", ansiBlue, nameWidth, gpu.Name, ansiResetFg)
+		b.WriteString(" | ")
+
+		if gpu.Temperature >= 60 {
+			b.WriteString(ansiBold)
+		}
+		fmt.Fprintf(&b, "%s%dC%s", ansiRed, gpu.Temperature, ansiResetFg)
+
+		if o.ShowFan {
+			b.WriteString(", ")
+			if gpu.FanSpeed >= 70 {
+				b.WriteString(ansiBold)
+			}
+			fmt.Fprintf(&b, "%s%3d %%%s", ansiCyanI, gpu.FanSpeed, ansiResetFg)
+		}
+
+		b.WriteString(", ")
+		if gpu.Utilization >= 70 {
+			b.WriteString(ansiBold)
+		}
+		fmt.Fprintf(&b, "%s%3d %%%s", ansiGreen, gpu.Utilization, ansiResetFg)
+
+		if o.ShowPower {
+			b.WriteString(", ")
+			if gpu.PowerLimit > 0 && gpu.PowerDraw/gpu.PowerLimit >= 0.7 {
+				b.WriteString(ansiBold)
+			}
+			fmt.Fprintf(&b, "%s%3d%s", ansiPurple, int(gpu.PowerDraw), ansiResetFg)
+			b.WriteString(" / ")
+			fmt.Fprintf(&b, "%s%3d W%s", ansiPurple, int(gpu.PowerLimit), ansiResetFg)
+		}
+
+		b.WriteString(" | ")
+
+		memoryWidth := len(strconv.FormatUint(gpu.MemoryTotal, 10))
+		fmt.Fprintf(&b, "%s%s%*d%s", ansiBold, ansiYellow, memoryWidth, gpu.MemoryUsed, ansiResetFg)
+		b.WriteString(" / ")
+		fmt.Fprintf(&b, "%s%*d%s", ansiYellow, memoryWidth, gpu.MemoryTotal, ansiResetFg)
+		b.WriteString(" MB |")
+
+		for _, p := range gpu.Processes {
+			b.WriteString(" ")
+			renderProcess(&b, &p, o)
+		}
+
+		lines = append(lines, b.String())
+	}
+
+	return lines
+}
+
+func renderProcess(b *strings.Builder, p *GPUProcess, o *RenderOptions) {
+	if o.showUser() {
+		fmt.Fprintf(b, "%s%s%s", ansiDark, o.owner(p.User, p.Group), ansiResetFg)
+	}
+	if o.ShowWorkload && p.Workload != nil {
+		if o.showUser() {
+			b.WriteString("@")
+		}
+		fmt.Fprintf(b, "%s%s%s", ansiBlue, p.Workload, ansiResetFg)
+	}
+	if o.showCmd() {
+		if o.showUser() || (o.ShowWorkload && p.Workload != nil) {
+			b.WriteString(":")
+		}
+		command := p.Command
+		if !o.ShowFullCmd {
+			command = shortCommand(command)
+		}
+		fmt.Fprintf(b, "%s%s%s", ansiCyanI, command, ansiResetFg)
+	}
+	if o.ShowPID {
+		if o.showUser() || o.showCmd() || (o.ShowWorkload && p.Workload != nil) {
+			b.WriteString("/")
+		}
+		fmt.Fprintf(b, "%s%d%s", ansiResetFg, p.PID, ansiResetFg)
+	}
+	fmt.Fprintf(b, "(%s%dM%s)", ansiYellow, p.UsedMemory, ansiResetFg)
+}
+
+// shortCommand is the program name of the command line. Kernel threads are
+// kept as they are.
+// e.g. /usr/bin/python3 train.py -> python3
+func shortCommand(command string) string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 || strings.HasPrefix(command, "[") {
+		return command
+	}
+	return path.Base(fields[0])
+}
+
+// elapsedTime formats seconds like the etime of ps(1).
+// e.g. 2-03:04:05
+func elapsedTime(seconds uint64) string {
+	days := seconds / 86400
+	hours := seconds / 3600 % 24
+	minutes := seconds / 60 % 60
+	seconds %= 60
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%d-%02d:%02d:%02d", days, hours, minutes, seconds)
+	case hours > 0:
+		return fmt.Sprintf("%02d:%02d:%02d", hours, minutes, seconds)
+	}
+	return fmt.Sprintf("%02d:%02d", minutes, seconds)
+}
+
+func renderTopProcess(p *ProcessStat, o *RenderOptions) string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s%6.1f %%%s ", ansiGreen, p.CPU, ansiResetFg)
+	fmt.Fprintf(&b, "%s%7s%s ", ansiYellow, humanBytes(p.RSS), ansiResetFg)
+	fmt.Fprintf(&b, "%11s ", elapsedTime(p.Elapsed))
+
+	if o.showUser() {
+		fmt.Fprintf(&b, "%s%s%s", ansiDark, o.owner(p.User, p.Group), ansiResetFg)
+	}
+	if o.ShowWorkload && p.Workload != nil {
+		if o.showUser() {
+			b.WriteString("@")
+		}
+		fmt.Fprintf(&b, "%s%s%s", ansiBlue, p.Workload, ansiResetFg)
+	}
+	if o.ShowPID {
+		if o.showUser() || (o.ShowWorkload && p.Workload != nil) {
+			b.WriteString("/")
+		}
+		fmt.Fprintf(&b, "%d", p.PID)
+	}
+	if o.showCmd() {
+		if o.showUser() || o.ShowPID || (o.ShowWorkload && p.Workload != nil) {
+			b.WriteString(":")
+		}
+		command := p.Command
+		if !o.ShowFullCmd {
+			command = shortCommand(command)
+		}
+		fmt.Fprintf(&b, "%s%s%s", ansiCyanI, command, ansiResetFg)
+	}
+
+	return b.String()
+}
+
+// idleUserRSS is the memory a user with no GPU process nor CPU in use is
+// still shown at, such as one holding data in an idle notebook.
+const idleUserRSS = 1 << 30
+
+// renderUsers renders users having GPU processes, using CPU or holding
+// memory.
+func renderUsers(users []UserStat) []string {
+	nameWidth := 0
+	for _, user := range users {
+		if len(user.User) > nameWidth {
+			nameWidth = len(user.User)
+		}
+	}
+
+	lines := []string{}
+	for _, user := range users {
+		if user.GPUs == 0 && user.CPU < 1 && user.RSS < idleUserRSS {
+			continue
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s%-*s%s | ", ansiDark, nameWidth, user.User, ansiResetFg)
+		fmt.Fprintf(&b, "%s%6.1f %%%s ", ansiGreen, user.CPU, ansiResetFg)
+		fmt.Fprintf(&b, "%s%7s%s ", ansiYellow, humanBytes(user.RSS), ansiResetFg)
+		fmt.Fprintf(&b, "%4d procs | ", user.Processes)
+		fmt.Fprintf(&b, "%s%d GPU%s ", ansiCyan, user.GPUs, ansiResetFg)
+		fmt.Fprintf(&b, "%s%dM%s", ansiYellow, user.GPUMemory, ansiResetFg)
+		lines = append(lines, b.String())
+	}
+	return lines
+}
@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const mib = 1024 * 1024
+
+// MetricsOptions selects labels of per-process metrics. Processes sharing the
+// same labels are summed up.
+type MetricsOptions struct {
+	ProcessUser bool
+	ProcessPID  bool
+}
+
+type metricLabel struct {
+	name  string
+	value string
+}
+
+type metricSample struct {
+	labels []metricLabel
+	value  float64
+}
+
+// metricFamily is a metric in the Prometheus text exposition format.
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+func (f *metricFamily) add(value float64, labels ...metricLabel) {
+	f.samples = append(f.samples, metricSample{labels: labels, value: value})
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (f *metricFamily) write(w io.Writer) {
+	if len(f.samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+	for _, sample := range f.samples {
+		io.WriteString(w, f.name)
+		if len(sample.labels) > 0 {
+			pairs := []string{}
+			for _, label := range sample.labels {
+				pairs = append(pairs, label.name+`="`+metricLabelEscaper.Replace(label.value)+`"`)
+			}
+			io.WriteString(w, "{"+strings.Join(pairs, ",")+"}")
+		}
+		fmt.Fprintf(w, " %s\n", strconv.FormatFloat(sample.value, 'g', -1, 64))
+	}
+}
+
+func gauge(name, help string) *metricFamily {
+	return &metricFamily{name: name, help: help, typ: "gauge"}
+}
+
+func counter(name, help string) *metricFamily {
+	return &metricFamily{name: name, help: help, typ: "counter"}
+}
+
+func gpuLabels(gpu *GPUStat) []metricLabel {
+	return []metricLabel{
+		{name: "gpu", value: strconv.Itoa(gpu.Index)},
+		{name: "uuid", value: gpu.UUID},
+		{name: "model", value: gpu.Name},
+	}
+}
+
+// writeMetrics writes the snapshot in the Prometheus text exposition format.
+func writeMetrics(w io.Writer, s *Snapshot, o *MetricsOptions) {
+	timestamp := gauge("mstat_snapshot_timestamp_seconds", "Unix time of the snapshot.")
+	timestamp.add(float64(s.Time.UnixNano()) / 1e9)
+
+	collectorFailures := gauge("mstat_collector_failures", "Consecutive failures of the collector.")
+	collectorLastSuccess := gauge("mstat_collector_last_success_timestamp_seconds", "Unix time of the last successful run of the collector.")
+	for _, status := range s.Collectors {
+		label := metricLabel{name: "collector", value: status.Name}
+		collectorFailures.add(float64(status.Failures), label)
+		if !status.LastSuccess.IsZero() {
+			collectorLastSuccess.add(float64(status.LastSuccess.UnixNano())/1e9, label)
+		}
+	}
+
+	cpuUsage := gauge("mstat_cpu_usage_ratio", "CPU usage of all cores.")
+	cpuCoreUsage := gauge("mstat_cpu_core_usage_ratio", "CPU usage per core.")
+	if s.CPU != nil {
+		cpuUsage.add(s.CPU.Total / 100)
+		for idx, usage := range s.CPU.Cores {
+			cpuCoreUsage.add(usage/100, metricLabel{name: "core", value: strconv.Itoa(idx)})
+		}
+	}
+
+	memoryTotal := gauge("mstat_memory_total_bytes", "Total memory.")
+	memoryUsed := gauge("mstat_memory_used_bytes", "Memory in use excluding buffers and cache.")
+	memoryBuffCache := gauge("mstat_memory_buff_cache_bytes", "Memory used by buffers and cache.")
+	memoryAvailable := gauge("mstat_memory_available_bytes", "Memory available for new applications.")
+	swapTotal := gauge("mstat_swap_total_bytes", "Total swap.")
+	swapUsed := gauge("mstat_swap_used_bytes", "Swap in use.")
+	if s.Memory != nil {
+		memoryTotal.add(float64(s.Memory.Total))
+		memoryUsed.add(float64(s.Memory.Used))
+		memoryBuffCache.add(float64(s.Memory.BuffCache))
+		memoryAvailable.add(float64(s.Memory.Available))
+		swapTotal.add(float64(s.Memory.SwapTotal))
+		swapUsed.add(float64(s.Memory.SwapUsed))
+	}
+
+	diskTotal := gauge("mstat_filesystem_size_bytes", "Size of the filesystem.")
+	diskUsed := gauge("mstat_filesystem_used_bytes", "Space in use on the filesystem.")
+	diskAvailable := gauge("mstat_filesystem_available_bytes", "Space available to non-root users on the filesystem.")
+	diskInodes := gauge("mstat_filesystem_inodes", "Inodes of the filesystem.")
+	diskInodesUsed := gauge("mstat_filesystem_inodes_used", "Inodes in use on the filesystem.")
+	for _, disk := range s.Disks {
+		labels := []metricLabel{
+			{name: "mountpoint", value: disk.MountPoint},
+			{name: "device", value: disk.Device},
+			{name: "fstype", value: disk.FSType},
+		}
+		diskTotal.add(float64(disk.Total), labels...)
+		diskUsed.add(float64(disk.Used), labels...)
+		diskAvailable.add(float64(disk.Available), labels...)
+		diskInodes.add(float64(disk.Inodes), labels...)
+		diskInodesUsed.add(float64(disk.InodesUsed), labels...)
+	}
+
+	networkReceive := counter("mstat_network_receive_bytes_total", "Bytes received on the interface.")
+	networkTransmit := counter("mstat_network_transmit_bytes_total", "Bytes transmitted on the interface.")
+	for _, network := range s.Network {
+		label := metricLabel{name: "interface", value: network.Interface}
+		networkReceive.add(float64(network.RxBytes), label)
+		networkTransmit.add(float64(network.TxBytes), label)
+	}
+
+	diskRead := counter("mstat_disk_read_bytes_total", "Bytes read from the device.")
+	diskWritten := counter("mstat_disk_written_bytes_total", "Bytes written to the device.")
+	diskReads := counter("mstat_disk_reads_completed_total", "Reads completed on the device.")
+	diskWrites := counter("mstat_disk_writes_completed_total", "Writes completed on the device.")
+	for _, io := range s.DiskIO {
+		label := metricLabel{name: "device", value: io.Device}
+		diskRead.add(float64(io.ReadBytes), label)
+		diskWritten.add(float64(io.WrittenBytes), label)
+		diskReads.add(float64(io.Reads), label)
+		diskWrites.add(float64(io.Writes), label)
+	}
+
+	userProcesses := gauge("mstat_user_processes", "Number of processes of the user.")
+	userCPUUsage := gauge("mstat_user_cpu_usage_cores", "CPU usage of processes of the user in cores.")
+	userRSS := gauge("mstat_user_memory_rss_bytes", "Resident memory of processes of the user.")
+	userGPUs := gauge("mstat_user_gpus", "Number of GPUs the user has processes on.")
+	userGPUMemory := gauge("mstat_user_gpu_memory_used_bytes", "GPU memory used by processes of the user.")
+	for _, user := range s.Users {
+		label := metricLabel{name: "user", value: user.User}
+		userProcesses.add(float64(user.Processes), label)
+		userCPUUsage.add(user.CPU/100, label)
+		userRSS.add(float64(user.RSS), label)
+		userGPUs.add(float64(user.GPUs), label)
+		userGPUMemory.add(float64(user.GPUMemory*mib), label)
+	}
+
+	gpuUtilization := gauge("mstat_gpu_utilization_ratio", "GPU utilization.")
+	gpuMemoryUsed := gauge("mstat_gpu_memory_used_bytes", "GPU memory in use.")
+	gpuMemoryTotal := gauge("mstat_gpu_memory_total_bytes", "Total GPU memory.")
+	gpuTemperature := gauge("mstat_gpu_temperature_celsius", "GPU temperature.")
+	gpuPowerDraw := gauge("mstat_gpu_power_draw_watts", "GPU power draw.")
+	gpuPowerLimit := gauge("mstat_gpu_power_limit_watts", "GPU power limit.")
+	gpuFanSpeed := gauge("mstat_gpu_fan_speed_ratio", "GPU fan speed.")
+	gpuProcesses := gauge("mstat_gpu_processes", "Number of compute processes on the GPU.")
+	gpuProcessMemory := gauge("mstat_gpu_process_memory_used_bytes", "GPU memory used by compute processes.")
+
+	for idx := range s.GPUs {
+		gpu := &s.GPUs[idx]
+		labels := gpuLabels(gpu)
+
+		gpuUtilization.add(float64(gpu.Utilization)/100, labels...)
+		gpuMemoryUsed.add(float64(gpu.MemoryUsed*mib), labels...)
+		gpuMemoryTotal.add(float64(gpu.MemoryTotal*mib), labels...)
+		gpuTemperature.add(float64(gpu.Temperature), labels...)
+		gpuPowerDraw.add(gpu.PowerDraw, labels...)
+		gpuPowerLimit.add(gpu.PowerLimit, labels...)
+		gpuFanSpeed.add(float64(gpu.FanSpeed)/100, labels...)
+		gpuProcesses.add(float64(len(gpu.Processes)), labels...)
+
+		// sum up processes having the same labels
+		keys := []string{}
+		usage := map[string]uint64{}
+		processLabels := map[string][]metricLabel{}
+		for _, p := range gpu.Processes {
+			extra := []metricLabel{}
+			if o.ProcessUser {
+				extra = append(extra, metricLabel{name: "user", value: p.User})
+			}
+			if o.ProcessPID {
+				extra = append(extra, metricLabel{name: "pid", value: strconv.Itoa(p.PID)})
+			}
+			key := fmt.Sprint(extra)
+			if _, ok := usage[key]; !ok {
+				keys = append(keys, key)
+				processLabels[key] = append(append([]metricLabel{}, labels...), extra...)
+			}
+			usage[key] += p.UsedMemory
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			gpuProcessMemory.add(float64(usage[key]*mib), processLabels[key]...)
+		}
+	}
+
+	for _, family := range []*metricFamily{
+		timestamp,
+		collectorFailures, collectorLastSuccess,
+		cpuUsage, cpuCoreUsage,
+		memoryTotal, memoryUsed, memoryBuffCache, memoryAvailable, swapTotal, swapUsed,
+		diskTotal, diskUsed, diskAvailable, diskInodes, diskInodesUsed,
+		networkReceive, networkTransmit,
+		diskRead, diskWritten, diskReads, diskWrites,
+		userProcesses, userCPUUsage, userRSS, userGPUs, userGPUMemory,
+		gpuUtilization, gpuMemoryUsed, gpuMemoryTotal, gpuTemperature,
+		gpuPowerDraw, gpuPowerLimit, gpuFanSpeed, gpuProcesses, gpuProcessMemory,
+	} {
+		family.write(w)
+	}
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func metricsSnapshot() *Snapshot {
+	collected := time.Unix(1700000000, 0)
+	return &Snapshot{
+		Time: collected,
+		Collectors: []CollectorStatus{
+			{Name: "gpu", LastSuccess: collected},
+			{Name: "disk", LastError: "timeout", LastFailure: collected, Failures: 2},
+		},
+		CPU: &CPUStat{Total: 25, Cores: []float64{50, 0}},
+		Users: []UserStat{
+			{User: "alice", Processes: 2, CPU: 150, RSS: 1024, GPUs: 1, GPUMemory: 6},
+		},
+		GPUs: []GPUStat{{
+			Index:       0,
+			UUID:        "GPU-0",
+			Name:        `Tesla "V100"`,
+			Temperature: 40,
+			Utilization: 50,
+			FanSpeed:    30,
+			PowerDraw:   100.5,
+			PowerLimit:  300,
+			MemoryUsed:  3,
+			MemoryTotal: 16,
+			Processes: []GPUProcess{
+				{PID: 20, User: "a\\b\nc", UsedMemory: 1},
+				{PID: 10, User: "alice", UsedMemory: 2},
+				{PID: 30, User: "alice", UsedMemory: 4},
+			},
+		}},
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	golden := filepath.Join("testdata", "metrics", "snapshot.prom")
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	writeMetrics(&b, metricsSnapshot(), &MetricsOptions{ProcessUser: true})
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("writeMetrics() =\n%s\nwant %s\n%s", b.Bytes(), golden, want)
+	}
+}
+
+func TestWriteMetricsProcessLabels(t *testing.T) {
+	const (
+		name   = "mstat_gpu_process_memory_used_bytes"
+		labels = `gpu="0",uuid="GPU-0",model="Tesla \"V100\""`
+	)
+
+	tests := []struct {
+		name    string
+		options MetricsOptions
+		want    []string
+	}{
+		{
+			name:    "user",
+			options: MetricsOptions{ProcessUser: true},
+			want: []string{
+				name + `{` + labels + `,user="a\\b\nc"} 1.048576e+06`,
+				name + `{` + labels + `,user="alice"} 6.291456e+06`,
+			},
+		},
+		{
+			name:    "pid",
+			options: MetricsOptions{ProcessPID: true},
+			want: []string{
+				name + `{` + labels + `,pid="10"} 2.097152e+06`,
+				name + `{` + labels + `,pid="20"} 1.048576e+06`,
+				name + `{` + labels + `,pid="30"} 4.194304e+06`,
+			},
+		},
+		{
+			name:    "user and pid",
+			options: MetricsOptions{ProcessUser: true, ProcessPID: true},
+			want: []string{
+				name + `{` + labels + `,user="a\\b\nc",pid="20"} 1.048576e+06`,
+				name + `{` + labels + `,user="alice",pid="10"} 2.097152e+06`,
+				name + `{` + labels + `,user="alice",pid="30"} 4.194304e+06`,
+			},
+		},
+		{
+			name:    "none",
+			options: MetricsOptions{},
+			want: []string{
+				name + `{` + labels + `} 7.340032e+06`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			writeMetrics(&b, metricsSnapshot(), &tt.options)
+
+			got := []string{}
+			for _, line := range strings.Split(b.String(), "\n") {
+				if strings.HasPrefix(line, name+"{") {
+					got = append(got, line)
+				}
+			}
+			if strings.Join(got, "\n") != strings.Join(tt.want, "\n") {
+				t.Errorf("writeMetrics() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestWriteMetricsEmpty(t *testing.T) {
+	var b bytes.Buffer
+	writeMetrics(&b, &Snapshot{Time: time.Unix(1700000000, 0)}, &MetricsOptions{})
+
+	want := "# HELP mstat_snapshot_timestamp_seconds Unix time of the snapshot.\n" +
+		"# TYPE mstat_snapshot_timestamp_seconds gauge\n" +
+		"mstat_snapshot_timestamp_seconds 1.7e+09\n"
+	if b.String() != want {
+		t.Errorf("writeMetrics() = %q, want %q", b.String(), want)
+	}
+}
@@ -0,0 +1,87 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// heartbeatInterval is how often the exporter tells a subscribed server
+	// that it is alive while no snapshot is published.
+	heartbeatInterval = 10 * time.Second
+	// heartbeatTimeout is how long the server waits for a message of a
+	// subscribed exporter before taking it as offline.
+	heartbeatTimeout = 3 * heartbeatInterval
+	// writeTimeout is how long writing a message may take.
+	writeTimeout = 10 * time.Second
+
+	messageSnapshot  = "snapshot"
+	messageHeartbeat = "heartbeat"
+)
+
+// StreamMessage is pushed to a server subscribed with "subscribe". Seq is
+// the one of the latest snapshot sent, and HTML is only sent with snapshots.
+type StreamMessage struct {
+	Type string    `json:"type"`
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	HTML string    `json:"html,omitempty"`
+}
+
+func snapshotMessage(frame *Frame) StreamMessage {
+	return StreamMessage{
+		Type: messageSnapshot,
+		Seq:  frame.Seq,
+		Time: frame.Snapshot.Time,
+		HTML: string(frame.HTML),
+	}
+}
+
+// serveStream pushes each snapshot to the server as it is published, and a
+// heartbeat when none is for heartbeatInterval, until the connection
+// breaks. The latest snapshot, or a heartbeat before the first one, is sent
+// right away to acknowledge the subscription.
+func serveStream(ws *websocket.Conn) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// nothing is expected from the server, but reading notices it is gone
+	go func() {
+		defer cancel()
+		for {
+			if _, _, err := ws.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	var seq uint64
+	message := StreamMessage{Type: messageHeartbeat, Time: time.Now()}
+	if frame := store.Latest(); frame != nil {
+		message = snapshotMessage(frame)
+	}
+
+	for {
+		_ = ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if err := ws.WriteJSON(message); err != nil {
+			log.Warn("Write to server is failed: ", err)
+			return
+		}
+		seq = message.Seq
+
+		waitCtx, waitCancel := context.WithTimeout(ctx, heartbeatInterval)
+		frame, err := store.Next(waitCtx, seq)
+		waitCancel()
+		if ctx.Err() != nil {
+			log.Info("Subscription of server is closed")
+			return
+		}
+		if err != nil {
+			message = StreamMessage{Type: messageHeartbeat, Seq: seq, Time: time.Now()}
+		} else {
+			message = snapshotMessage(frame)
+		}
+	}
+}
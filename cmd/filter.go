@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// nameFilter selects interfaces or devices by name. A name is selected if it
+// matches the include pattern and does not match the exclude pattern. Empty
+// patterns are ignored.
+type nameFilter struct {
+	include *regexp.Regexp
+	exclude *regexp.Regexp
+}
+
+func newNameFilter(include, exclude string) (*nameFilter, error) {
+	f := &nameFilter{}
+	var err error
+	if include != "" {
+		if f.include, err = regexp.Compile(include); err != nil {
+			return nil, fmt.Errorf("invalid include pattern: %s", err)
+		}
+	}
+	if exclude != "" {
+		if f.exclude, err = regexp.Compile(exclude); err != nil {
+			return nil, fmt.Errorf("invalid exclude pattern: %s", err)
+		}
+	}
+	return f, nil
+}
+
+func (f *nameFilter) match(name string) bool {
+	if f.include != nil && !f.include.MatchString(name) {
+		return false
+	}
+	return f.exclude == nil || !f.exclude.MatchString(name)
+}
+
+// counterRate is the per second rate of a counter. Counters that went
+// backwards, by wrapping around or by a reset of the device, give zero.
+func counterRate(prev, cur uint64, seconds float64) float64 {
+	if cur < prev || seconds <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / seconds
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"math"
+	"testing"
+)
+
+func TestNameFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		include string
+		exclude string
+		match   []string
+		nomatch []string
+	}{
+		{
+			name:  "everything",
+			match: []string{"eth0", "lo", "sda"},
+		},
+		{
+			name:    "default network",
+			exclude: defaultNetExclude,
+			match:   []string{"eth0", "eno1", "ib0", "wlp2s0", "bond0"},
+			nomatch: []string{"lo", "veth1a2b3c", "docker0", "br-0123abcd", "cali12345", "cni0", "flannel.1", "virbr0", "ifb0"},
+		},
+		{
+			name:    "default disk I/O",
+			exclude: defaultDiskIOExclude,
+			match:   []string{"sda", "vdb", "nvme0n1", "mmcblk0", "md0", "dm-0"},
+			nomatch: []string{"loop0", "ram1", "zram0", "sr0", "sda1", "vdb2", "nvme0n1p1", "mmcblk0p2"},
+		},
+		{
+			name:    "include and exclude",
+			include: `^(eth|ib)`,
+			exclude: `^eth1$`,
+			match:   []string{"eth0", "ib0"},
+			nomatch: []string{"eth1", "eno1", "lo"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := newNameFilter(tt.include, tt.exclude)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range tt.match {
+				if !f.match(name) {
+					t.Errorf("%s is not selected", name)
+				}
+			}
+			for _, name := range tt.nomatch {
+				if f.match(name) {
+					t.Errorf("%s is selected", name)
+				}
+			}
+		})
+	}
+
+	if _, err := newNameFilter("(", ""); err == nil {
+		t.Error("newNameFilter() succeeded with an invalid include pattern")
+	}
+	if _, err := newNameFilter("", "["); err == nil {
+		t.Error("newNameFilter() succeeded with an invalid exclude pattern")
+	}
+}
+
+func TestCounterRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		prev    uint64
+		cur     uint64
+		seconds float64
+		want    float64
+	}{
+		{name: "increase", prev: 1000, cur: 3000, seconds: 2, want: 1000},
+		{name: "unchanged", prev: 1000, cur: 1000, seconds: 1, want: 0},
+		{name: "fraction of a second", prev: 0, cur: 50, seconds: 0.5, want: 100},
+		{name: "reset", prev: 1000, cur: 10, seconds: 1, want: 0},
+		{name: "wrap around", prev: math.MaxUint64 - 10, cur: 5, seconds: 1, want: 0},
+		{name: "up to the maximum", prev: math.MaxUint64 - 10, cur: math.MaxUint64, seconds: 1, want: 10},
+		{name: "no time", prev: 0, cur: 100, seconds: 0, want: 0},
+		{name: "clock went back", prev: 0, cur: 100, seconds: -1, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := counterRate(tt.prev, tt.cur, tt.seconds); got != tt.want {
+			t.Errorf("%s: counterRate(%d, %d, %g) = %g, want %g", tt.name, tt.prev, tt.cur, tt.seconds, got, tt.want)
+		}
+	}
+}
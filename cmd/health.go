@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// HealthOptions are thresholds of /healthz and /readyz. The exporter is live
+// as long as snapshots keep coming within LiveMaxAge, and ready when every
+// collector succeeded within ReadyMaxAge.
+type HealthOptions struct {
+	LiveMaxAge  time.Duration
+	ReadyMaxAge time.Duration
+	started     time.Time
+}
+
+// CollectorHealth is the status of a collector with the seconds since its
+// last success, which is null if it never succeeded.
+type CollectorHealth struct {
+	CollectorStatus
+	Age *float64 `json:"age_seconds"`
+}
+
+type Health struct {
+	Status string `json:"status"`
+	// Age is the seconds since the last snapshot, which is null before the
+	// first one.
+	Age        *float64          `json:"age_seconds"`
+	Collectors []CollectorHealth `json:"collectors"`
+	Reasons    []string          `json:"reasons,omitempty"`
+}
+
+func NewHealthOptions(liveMaxAge, readyMaxAge time.Duration) *HealthOptions {
+	return &HealthOptions{
+		LiveMaxAge:  liveMaxAge,
+		ReadyMaxAge: readyMaxAge,
+		started:     time.Now(),
+	}
+}
+
+func secondsSince(t time.Time, now time.Time) *float64 {
+	if t.IsZero() {
+		return nil
+	}
+	seconds := now.Sub(t).Seconds()
+	return &seconds
+}
+
+// check tells the health of the snapshot, which is nil before the first
+// one. Collectors are only considered for readiness.
+func (o *HealthOptions) check(snapshot *Snapshot, ready bool) *Health {
+	now := time.Now()
+	health := &Health{Collectors: []CollectorHealth{}}
+
+	maxAge := o.LiveMaxAge
+	if ready {
+		maxAge = o.ReadyMaxAge
+	}
+
+	if snapshot == nil {
+		// the first collection may take up to the timeout of every collector
+		if ready || now.Sub(o.started) > maxAge {
+			health.Reasons = append(health.Reasons, "no snapshot is collected")
+		}
+	} else {
+		health.Age = secondsSince(snapshot.Time, now)
+		if now.Sub(snapshot.Time) > maxAge {
+			health.Reasons = append(health.Reasons, "snapshot is older than "+maxAge.String())
+		}
+
+		for _, status := range snapshot.Collectors {
+			health.Collectors = append(health.Collectors, CollectorHealth{
+				CollectorStatus: status,
+				Age:             secondsSince(status.LastSuccess, now),
+			})
+			if !ready {
+				continue
+			}
+			if status.Failing() {
+				health.Reasons = append(health.Reasons, "collector "+status.Name+" is failing: "+status.LastError)
+			} else if now.Sub(status.LastSuccess) > maxAge {
+				health.Reasons = append(health.Reasons, "collector "+status.Name+" did not succeed for "+maxAge.String())
+			}
+		}
+	}
+
+	health.Status = "ok"
+	if len(health.Reasons) > 0 {
+		health.Status = "fail"
+	}
+	return health
+}
+
+func (o *HealthOptions) serve(response http.ResponseWriter, request *http.Request, ready bool) {
+	if request.Method != "GET" && request.Method != "HEAD" {
+		http.Error(response, "405 method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var snapshot *Snapshot
+	if frame := store.Latest(); frame != nil {
+		snapshot = frame.Snapshot
+	}
+	health := o.check(snapshot, ready)
+
+	response.Header().Set("Content-Type", "application/json")
+	if len(health.Reasons) > 0 {
+		response.WriteHeader(http.StatusServiceUnavailable)
+	}
+	if err := json.NewEncoder(response).Encode(health); err != nil {
+		log.Warn("Write health is failed: ", err)
+	}
+}
+
+// healthzHandler fails when collection is stuck, so that the exporter is
+// restarted.
+func (o *HealthOptions) healthzHandler(response http.ResponseWriter, request *http.Request) {
+	o.serve(response, request, false)
+}
+
+// readyzHandler fails when a collector is failing or its data is stale, so
+// that the exporter is taken out of service until it recovers.
+func (o *HealthOptions) readyzHandler(response http.ResponseWriter, request *http.Request) {
+	o.serve(response, request, true)
+}
@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// useStore replaces the store of the exporter for the test.
+func useStore(t *testing.T) *Store {
+	t.Helper()
+
+	previous := store
+	store = NewStore()
+	t.Cleanup(func() { store = previous })
+	return store
+}
+
+func TestHealth(t *testing.T) {
+	const (
+		liveMaxAge  = 5 * time.Minute
+		readyMaxAge = time.Minute
+	)
+	now := time.Now()
+	succeeded := CollectorStatus{Name: "cpu", LastSuccess: now}
+
+	tests := []struct {
+		name      string
+		started   time.Time
+		snapshot  *Snapshot
+		wantLive  int
+		wantReady int
+	}{
+		{
+			name:      "starting",
+			started:   now,
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+		},
+		{
+			name:      "never collected",
+			started:   now.Add(-2 * liveMaxAge),
+			wantLive:  http.StatusServiceUnavailable,
+			wantReady: http.StatusServiceUnavailable,
+		},
+		{
+			name:      "healthy",
+			started:   now,
+			snapshot:  &Snapshot{Time: now, Collectors: []CollectorStatus{succeeded}},
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusOK,
+		},
+		{
+			name:      "stuck",
+			started:   now.Add(-time.Hour),
+			snapshot:  &Snapshot{Time: now.Add(-2 * liveMaxAge), Collectors: []CollectorStatus{succeeded}},
+			wantLive:  http.StatusServiceUnavailable,
+			wantReady: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "collector failing",
+			started: now,
+			snapshot: &Snapshot{Time: now, Collectors: []CollectorStatus{
+				succeeded,
+				{Name: "gpu", LastSuccess: now.Add(-time.Second), LastError: "driver", LastFailure: now, Failures: 1},
+			}},
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "collector stale",
+			started: now.Add(-time.Hour),
+			snapshot: &Snapshot{Time: now, Collectors: []CollectorStatus{
+				succeeded,
+				{Name: "disk", LastSuccess: now.Add(-2 * readyMaxAge)},
+			}},
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+		},
+		{
+			name:    "collector never succeeded",
+			started: now,
+			snapshot: &Snapshot{Time: now, Collectors: []CollectorStatus{
+				succeeded,
+				{Name: "disk", LastError: "timeout", LastFailure: now, Failures: 1},
+			}},
+			wantLive:  http.StatusOK,
+			wantReady: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := useStore(t)
+			if tt.snapshot != nil {
+				s.Publish(tt.snapshot, nil, nil)
+			}
+			o := NewHealthOptions(liveMaxAge, readyMaxAge)
+			o.started = tt.started
+
+			for _, probe := range []struct {
+				path    string
+				handler http.HandlerFunc
+				want    int
+			}{
+				{path: "/healthz", handler: o.healthzHandler, want: tt.wantLive},
+				{path: "/readyz", handler: o.readyzHandler, want: tt.wantReady},
+			} {
+				response := httptest.NewRecorder()
+				probe.handler(response, httptest.NewRequest("GET", probe.path, nil))
+				if response.Code != probe.want {
+					t.Errorf("GET %s = %d, want %d: %s", probe.path, response.Code, probe.want, response.Body)
+				}
+
+				health := Health{}
+				if err := json.Unmarshal(response.Body.Bytes(), &health); err != nil {
+					t.Fatalf("GET %s: %s", probe.path, err)
+				}
+				wantStatus := "ok"
+				if probe.want != http.StatusOK {
+					wantStatus = "fail"
+				}
+				if health.Status != wantStatus || (wantStatus == "fail") != (len(health.Reasons) > 0) {
+					t.Errorf("GET %s = %+v, want status %s", probe.path, health, wantStatus)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthMethod(t *testing.T) {
+	useStore(t)
+	o := NewHealthOptions(time.Minute, time.Minute)
+
+	response := httptest.NewRecorder()
+	o.healthzHandler(response, httptest.NewRequest("POST", "/healthz", nil))
+	if response.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST /healthz = %d, want %d", response.Code, http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,136 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// History keeps recent snapshots in a ring buffer, at most one per
+// resolution, so that clients can catch up with what they missed.
+type History struct {
+	snapshots  []*Snapshot
+	next       int
+	full       bool
+	resolution time.Duration
+	mu         *sync.Mutex
+}
+
+// NewHistory keeps snapshots of the last length at the resolution.
+func NewHistory(length, resolution time.Duration) *History {
+	if resolution <= 0 {
+		resolution = time.Second
+	}
+	size := int(length / resolution)
+	if size < 1 {
+		size = 1
+	}
+	return &History{
+		snapshots:  make([]*Snapshot, size),
+		resolution: resolution,
+		mu:         new(sync.Mutex),
+	}
+}
+
+// Add keeps the snapshot if it is the first one of its period of the
+// resolution. Periods are aligned to the clock, so that jitter of collection
+// does not make a period be skipped.
+func (h *History) Add(s *Snapshot) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if last := h.last(); last != nil && !s.Time.Truncate(h.resolution).After(last.Time.Truncate(h.resolution)) {
+		return
+	}
+	h.snapshots[h.next] = s
+	h.next = (h.next + 1) % len(h.snapshots)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+func (h *History) last() *Snapshot {
+	if h.next == 0 && !h.full {
+		return nil
+	}
+	return h.snapshots[(h.next+len(h.snapshots)-1)%len(h.snapshots)]
+}
+
+// Since returns snapshots taken after the time from the oldest, one for each
+// period of the step.
+func (h *History) Since(since time.Time, step time.Duration) []*Snapshot {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ordered := h.snapshots[:h.next]
+	if h.full {
+		ordered = append(append([]*Snapshot{}, h.snapshots[h.next:]...), ordered...)
+	}
+
+	snapshots := []*Snapshot{}
+	var last time.Time
+	for _, s := range ordered {
+		if !s.Time.After(since) {
+			continue
+		}
+		if len(snapshots) > 0 && !s.Time.Truncate(step).After(last.Truncate(step)) {
+			continue
+		}
+		snapshots = append(snapshots, s)
+		last = s.Time
+	}
+	return snapshots
+}
+
+// parseTime accepts RFC 3339 or Unix time in seconds.
+// e.g. 2006-01-02T15:04:05Z or 1136214245
+func parseTime(value string) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(seconds*1e9)), nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// parseStep accepts a duration or seconds.
+// e.g. 30s or 30
+func parseStep(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Duration(seconds * float64(time.Second)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// historyHandler serves snapshots since the time given by 'since', which
+// defaults to the oldest one, one for each period of 'step'.
+func (h *History) historyHandler(response http.ResponseWriter, request *http.Request) {
+	if request.Method != "GET" {
+		http.Error(response, "405 method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := request.URL.Query()
+	var since time.Time
+	if value := query.Get("since"); value != "" {
+		var err error
+		if since, err = parseTime(value); err != nil {
+			http.Error(response, fmt.Sprintf("400 invalid since: %s", err), http.StatusBadRequest)
+			return
+		}
+	}
+	var step time.Duration
+	if value := query.Get("step"); value != "" {
+		var err error
+		if step, err = parseStep(value); err != nil || step < 0 {
+			http.Error(response, fmt.Sprintf("400 invalid step: %s", value), http.StatusBadRequest)
+			return
+		}
+	}
+
+	response.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(response).Encode(h.Since(since, step)); err != nil {
+		log.Warn("Write history is failed: ", err)
+	}
+}
@@ -0,0 +1,147 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var historyEpoch = time.Date(2026, 1, 2, 3, 4, 0, 0, time.UTC)
+
+// at is a snapshot taken the seconds after historyEpoch.
+func at(seconds float64) *Snapshot {
+	return &Snapshot{Time: historyEpoch.Add(time.Duration(seconds * float64(time.Second)))}
+}
+
+// offsets are the seconds after historyEpoch the snapshots were taken at.
+func offsets(snapshots []*Snapshot) []float64 {
+	seconds := []float64{}
+	for _, s := range snapshots {
+		seconds = append(seconds, s.Time.Sub(historyEpoch).Seconds())
+	}
+	return seconds
+}
+
+func TestHistoryAdd(t *testing.T) {
+	h := NewHistory(5*time.Second, time.Second)
+	// the second one of a period and one going back in time are dropped
+	for _, seconds := range []float64{0, 0.5, 1.2, 1.9, 2.1, 1.5, 3} {
+		h.Add(at(seconds))
+	}
+
+	want := []float64{0, 1.2, 2.1, 3}
+	if got := offsets(h.Since(time.Time{}, 0)); !reflect.DeepEqual(got, want) {
+		t.Errorf("Since() = %v, want %v", got, want)
+	}
+}
+
+func TestHistoryWraparound(t *testing.T) {
+	tests := []struct {
+		name  string
+		added int
+		want  []float64
+	}{
+		{name: "empty", added: 0, want: []float64{}},
+		{name: "partial", added: 3, want: []float64{0, 1, 2}},
+		{name: "full", added: 5, want: []float64{0, 1, 2, 3, 4}},
+		{name: "one over", added: 6, want: []float64{1, 2, 3, 4, 5}},
+		{name: "twice over", added: 12, want: []float64{7, 8, 9, 10, 11}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHistory(5*time.Second, time.Second)
+			for seconds := 0; seconds < tt.added; seconds++ {
+				h.Add(at(float64(seconds)))
+			}
+			if got := offsets(h.Since(time.Time{}, 0)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Since() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistorySince(t *testing.T) {
+	h := NewHistory(10*time.Second, time.Second)
+	for seconds := 0; seconds < 14; seconds++ {
+		h.Add(at(float64(seconds)))
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		want  []float64
+	}{
+		{name: "zero", since: time.Time{}, want: []float64{4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+		{name: "before oldest", since: at(3).Time, want: []float64{4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+		{name: "at oldest", since: at(4).Time, want: []float64{5, 6, 7, 8, 9, 10, 11, 12, 13}},
+		{name: "between", since: at(10.5).Time, want: []float64{11, 12, 13}},
+		{name: "just before newest", since: at(12.999).Time, want: []float64{13}},
+		{name: "at newest", since: at(13).Time, want: []float64{}},
+		{name: "after newest", since: at(60).Time, want: []float64{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offsets(h.Since(tt.since, 0)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Since(%s) = %v, want %v", tt.since, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryStep(t *testing.T) {
+	h := NewHistory(time.Minute, time.Second)
+	for seconds := 0; seconds < 20; seconds++ {
+		h.Add(at(float64(seconds)))
+	}
+
+	tests := []struct {
+		name  string
+		since time.Time
+		step  time.Duration
+		want  []float64
+	}{
+		{name: "resolution", step: time.Second, want: offsets(h.Since(time.Time{}, 0))},
+		{name: "5s", step: 5 * time.Second, want: []float64{0, 5, 10, 15}},
+		{name: "10s", step: 10 * time.Second, want: []float64{0, 10}},
+		// the first snapshot is kept, and the next ones are the first of
+		// their period
+		{name: "5s since", since: at(2).Time, step: 5 * time.Second, want: []float64{3, 5, 10, 15}},
+		{name: "longer than history", step: time.Hour, want: []float64{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := offsets(h.Since(tt.since, tt.step)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Since(%s, %s) = %v, want %v", tt.since, tt.step, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHistoryHandler(t *testing.T) {
+	h := NewHistory(time.Minute, time.Second)
+	h.Add(at(0))
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: http.StatusOK},
+		{query: "?since=1136214245&step=30", want: http.StatusOK},
+		{query: "?since=2006-01-02T15:04:05Z&step=30s", want: http.StatusOK},
+		{query: "?since=yesterday", want: http.StatusBadRequest},
+		{query: "?step=-1s", want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		response := httptest.NewRecorder()
+		h.historyHandler(response, httptest.NewRequest("GET", "/history"+tt.query, nil))
+		if response.Code != tt.want {
+			t.Errorf("GET /history%s = %d, want %d", tt.query, response.Code, tt.want)
+		}
+	}
+}
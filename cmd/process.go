@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+)
+
+// processOwner returns the UID and GID of the process.
+func processOwner(procPath string, pid int) (string, string, error) {
+	info, err := os.Stat(filepath.Join(procPath, strconv.Itoa(pid)))
+	if err != nil {
+		return "", "", err
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return "", "", fmt.Errorf("unable to get owner of process %d", pid)
+	}
+	return strconv.FormatUint(uint64(stat.Uid), 10), strconv.FormatUint(uint64(stat.Gid), 10), nil
+}
+
+// processCmdline returns the arguments of the process. Kernel threads and
+// zombies have no arguments.
+func processCmdline(procPath string, pid int) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "cmdline"))
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimRight(data, "\x00")
+	if len(data) == 0 {
+		return nil, nil
+	}
+	args := []string{}
+	for _, arg := range bytes.Split(data, []byte{0}) {
+		args = append(args, string(arg))
+	}
+	return args, nil
+}
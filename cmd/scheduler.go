@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"time"
+)
+
+const maxCollectorBackoff = 5 * time.Minute
+
+// Collector fills its part of the snapshot.
+type Collector interface {
+	Name() string
+	Collect(ctx context.Context, s *Snapshot) error
+}
+
+// CollectorStatus is the state of a collector. Failures is the number of
+// consecutive failures since the last success.
+type CollectorStatus struct {
+	Name        string    `json:"name"`
+	LastSuccess time.Time `json:"last_success"`
+	LastError   string    `json:"last_error,omitempty"`
+	LastFailure time.Time `json:"last_failure"`
+	Failures    int       `json:"failures"`
+
+	nextRun time.Time
+}
+
+// Failing tells whether the last run of the collector failed.
+func (s *CollectorStatus) Failing() bool {
+	return s.Failures > 0
+}
+
+// Scheduler runs collectors at an interval. A collector that fails is
+// retried with exponential backoff, and its part of the last good snapshot
+// is kept in the meantime.
+type Scheduler struct {
+	collectors []Collector
+	status     []*CollectorStatus
+	// abandoned are the results of collectors that timed out, which are
+	// not run again until they return
+	abandoned []chan collectResult
+	interval  time.Duration
+	timeout   time.Duration
+	last      *Snapshot
+}
+
+type collectResult struct {
+	part *Snapshot
+	err  error
+}
+
+func NewScheduler(interval, timeout time.Duration, collectors ...Collector) *Scheduler {
+	status := []*CollectorStatus{}
+	for _, collector := range collectors {
+		status = append(status, &CollectorStatus{Name: collector.Name()})
+	}
+	return &Scheduler{
+		collectors: collectors,
+		status:     status,
+		abandoned:  make([]chan collectResult, len(collectors)),
+		interval:   interval,
+		timeout:    timeout,
+		last: &Snapshot{
+			Disks:   []DiskStat{},
+			Network: []NetworkStat{},
+			DiskIO:  []DiskIOStat{},
+			GPUs:    []GPUStat{},
+
+			TopCPU:    []ProcessStat{},
+			TopMemory: []ProcessStat{},
+			Users:     []UserStat{},
+		},
+	}
+}
+
+func (s *Scheduler) backoff(failures int) time.Duration {
+	backoff := s.interval
+	for i := 1; i < failures && backoff < maxCollectorBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxCollectorBackoff {
+		backoff = maxCollectorBackoff
+	}
+	return backoff
+}
+
+// run runs the collector if it is due and returns its part of the snapshot,
+// or nil if it is not run or fails. A collector that does not return in time
+// is abandoned with the copy of the snapshot it writes to, and is not run
+// again until it returns.
+func (s *Scheduler) run(ctx context.Context, idx int, base *Snapshot) *Snapshot {
+	collector := s.collectors[idx]
+	status := s.status[idx]
+
+	if s.abandoned[idx] != nil {
+		select {
+		case <-s.abandoned[idx]:
+			// its result is too old to be used
+			s.abandoned[idx] = nil
+		default:
+		}
+	}
+
+	now := time.Now()
+	if now.Before(status.nextRun) {
+		return nil
+	}
+	if s.abandoned[idx] != nil {
+		s.fail(status, fmt.Errorf("still running after timeout"))
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	results := make(chan collectResult, 1)
+	go func() {
+		part := *base
+		err := collector.Collect(ctx, &part)
+		results <- collectResult{part: &part, err: err}
+	}()
+
+	var result collectResult
+	select {
+	case result = <-results:
+		if result.err != nil {
+			s.fail(status, result.err)
+			return nil
+		}
+	case <-ctx.Done():
+		// the collector may not honor the context, so it is not waited for
+		s.abandoned[idx] = results
+		log.Warnf("Collector %s timed out after %s", status.Name, s.timeout)
+		s.fail(status, ctx.Err())
+		return nil
+	}
+	if status.Failing() {
+		log.Infof("Collector %s is recovered after %d failures", status.Name, status.Failures)
+	}
+	status.LastSuccess = time.Now()
+	status.LastError = ""
+	status.Failures = 0
+	return result.part
+}
+
+func (s *Scheduler) fail(status *CollectorStatus, err error) {
+	status.LastError = err.Error()
+	status.LastFailure = time.Now()
+	status.Failures++
+	status.nextRun = status.LastFailure.Add(s.backoff(status.Failures))
+	log.Errorf("Collector %s failed %d times, retry in %s: %s",
+		status.Name, status.Failures, s.backoff(status.Failures), err)
+}
+
+// mergeSnapshot copies the parts a collector changed of the snapshot it
+// started from.
+func mergeSnapshot(snapshot, base, part *Snapshot) {
+	dst := reflect.ValueOf(snapshot).Elem()
+	from := reflect.ValueOf(base).Elem()
+	to := reflect.ValueOf(part).Elem()
+	for i := 0; i < to.NumField(); i++ {
+		if !reflect.DeepEqual(from.Field(i).Interface(), to.Field(i).Interface()) {
+			dst.Field(i).Set(to.Field(i))
+		}
+	}
+}
+
+// Collect runs due collectors once, each in a goroutine of its own. Parts of
+// collectors that are failing or backing off are taken from the previous
+// snapshot.
+func (s *Scheduler) Collect(ctx context.Context) *Snapshot {
+	base := *s.last
+	base.Time = time.Now()
+	if hostname, err := os.Hostname(); err == nil {
+		base.Host = hostname
+	}
+
+	parts := make([]*Snapshot, len(s.collectors))
+	var wg sync.WaitGroup
+	for idx := range s.collectors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			parts[idx] = s.run(ctx, idx, &base)
+		}()
+	}
+	wg.Wait()
+
+	snapshot := base
+	for _, part := range parts {
+		if part != nil {
+			mergeSnapshot(&snapshot, &base, part)
+		}
+	}
+
+	snapshot.Collectors = []CollectorStatus{}
+	for _, status := range s.status {
+		snapshot.Collectors = append(snapshot.Collectors, *status)
+	}
+
+	s.last = &snapshot
+	return &snapshot
+}
+
+// Run collects at the interval and calls update with each snapshot until
+// the context is done.
+func (s *Scheduler) Run(ctx context.Context, update func(*Snapshot)) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		update(s.Collect(ctx))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeCollector reports its total as the CPU, fails with err if it is set,
+// and blocks until block is closed if it is set, ignoring the context like
+// collectors reading /proc do.
+type fakeCollector struct {
+	mu    sync.Mutex
+	total float64
+	err   error
+	block chan struct{}
+	calls int
+}
+
+func (c *fakeCollector) Name() string {
+	return "fake"
+}
+
+func (c *fakeCollector) Collect(ctx context.Context, s *Snapshot) error {
+	c.mu.Lock()
+	c.calls++
+	total, err, block := c.total, c.err, c.block
+	c.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+	if err != nil {
+		return err
+	}
+	s.CPU = &CPUStat{Total: total}
+	return nil
+}
+
+func (c *fakeCollector) set(total float64, err error, block chan struct{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.total, c.err, c.block = total, err, block
+}
+
+func (c *fakeCollector) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+type gpuCollector struct{}
+
+func (gpuCollector) Name() string {
+	return "gpu"
+}
+
+func (gpuCollector) Collect(ctx context.Context, s *Snapshot) error {
+	s.GPUs = []GPUStat{{Index: 0, Utilization: 50}}
+	return nil
+}
+
+func TestSchedulerMerge(t *testing.T) {
+	cpu := &fakeCollector{total: 1}
+	s := NewScheduler(time.Minute, time.Second, cpu, gpuCollector{})
+
+	snapshot := s.Collect(context.Background())
+	if snapshot.CPU == nil || snapshot.CPU.Total != 1 {
+		t.Errorf("CPU = %+v, want total 1", snapshot.CPU)
+	}
+	if len(snapshot.GPUs) != 1 || snapshot.GPUs[0].Utilization != 50 {
+		t.Errorf("GPUs = %+v, want one at 50", snapshot.GPUs)
+	}
+	if len(snapshot.Collectors) != 2 {
+		t.Errorf("%d collectors are reported, want 2", len(snapshot.Collectors))
+	}
+}
+
+func TestSchedulerTimeout(t *testing.T) {
+	c := &fakeCollector{total: 1}
+	s := NewScheduler(time.Minute, 100*time.Millisecond, c)
+	status := s.status[0]
+
+	if snapshot := s.Collect(context.Background()); snapshot.CPU.Total != 1 {
+		t.Fatalf("CPU = %+v, want total 1", snapshot.CPU)
+	}
+
+	// the collector hangs, so the last value is kept and it is failing
+	block := make(chan struct{})
+	c.set(2, nil, block)
+	started := time.Now()
+	snapshot := s.Collect(context.Background())
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Collect() waited %s for the hanging collector", elapsed)
+	}
+	if snapshot.CPU.Total != 1 {
+		t.Errorf("CPU = %+v, want the last total 1", snapshot.CPU)
+	}
+	if !status.Failing() || status.LastError != context.DeadlineExceeded.Error() {
+		t.Errorf("status = %+v, want failing with %s", status, context.DeadlineExceeded)
+	}
+
+	// it is not run again while it hangs
+	status.nextRun = time.Time{}
+	s.Collect(context.Background())
+	if calls := c.count(); calls != 2 {
+		t.Errorf("collector is run %d times, want 2", calls)
+	}
+	if status.Failures != 2 {
+		t.Errorf("Failures = %d, want 2", status.Failures)
+	}
+
+	// the result of the abandoned run is dropped, and the next one is used
+	c.set(3, nil, nil)
+	close(block)
+	for deadline := time.Now().Add(5 * time.Second); len(s.abandoned[0]) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("abandoned collector did not return")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	status.nextRun = time.Time{}
+	snapshot = s.Collect(context.Background())
+	if snapshot.CPU.Total != 3 {
+		t.Errorf("CPU = %+v, want total 3", snapshot.CPU)
+	}
+	if status.Failing() || s.abandoned[0] != nil {
+		t.Errorf("status = %+v, want recovered", status)
+	}
+}
+
+func TestSchedulerBackoff(t *testing.T) {
+	c := &fakeCollector{err: errors.New("broken")}
+	s := NewScheduler(time.Minute, time.Second, c)
+	status := s.status[0]
+
+	for failures, want := range []time.Duration{
+		1: time.Minute,
+		2: 2 * time.Minute,
+		3: 4 * time.Minute,
+		4: maxCollectorBackoff,
+		5: maxCollectorBackoff,
+	} {
+		if failures == 0 {
+			continue
+		}
+		snapshot := s.Collect(context.Background())
+		if status.Failures != failures {
+			t.Fatalf("Failures = %d, want %d", status.Failures, failures)
+		}
+		if got := status.nextRun.Sub(status.LastFailure); got != want {
+			t.Errorf("retry after %d failures in %s, want %s", failures, got, want)
+		}
+		if snapshot.CPU != nil {
+			t.Errorf("CPU = %+v of a failing collector", snapshot.CPU)
+		}
+
+		// it is not run until the backoff is over
+		calls := c.count()
+		s.Collect(context.Background())
+		if c.count() != calls {
+			t.Errorf("collector is run during the backoff after %d failures", failures)
+		}
+		status.nextRun = time.Time{}
+	}
+
+	c.set(1, nil, nil)
+	if snapshot := s.Collect(context.Background()); snapshot.CPU == nil || snapshot.CPU.Total != 1 {
+		t.Errorf("CPU = %+v, want total 1", snapshot.CPU)
+	}
+	if status.Failing() || status.LastError != "" {
+		t.Errorf("status = %+v, want recovered", status)
+	}
+}
@@ -1,8 +1,11 @@
 package cmd
 
 import (
+	"crypto/sha256"
+	"crypto/tls"
 	"fmt"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -22,6 +25,16 @@ type ServerOptions struct {
 	Aliases     []string
 	Interval    int
 	Collapses   []string
+	Agents      []string
+	AgentToken  string
+	// credentials to present to exporters
+	ExporterAuth      string
+	ExporterToken     string
+	ExporterTokenFile string
+	// TLS of exporters of wss://
+	ExporterCA   string
+	ExporterCert string
+	ExporterKey  string
 }
 
 type IndexPageData struct {
@@ -31,63 +44,134 @@ type IndexPageData struct {
 }
 
 type ExporterInfo struct {
-	url      string
-	isOnline bool
-	ws       *websocket.Conn
-	status   string
-	mu       *sync.RWMutex
+	url    string
+	state  ExporterState
+	ws     *websocket.Conn
+	status string
+	mu     *sync.RWMutex
+	// lastSeen is when the last status arrived, and connectedAt when the
+	// connection was made
+	lastSeen    time.Time
+	connectedAt time.Time
+	// failures is the number of failures since the exporter was online,
+	// which the next dial is delayed by
+	failures     int
+	nextDial     time.Time
+	offlineSince time.Time
+	// agent is an exporter connecting to the server, which is not dialed
+	agent       bool
+	credentials *Credentials
+	scheme      string
+	tlsConfig   *tls.Config
+	// streaming exporters push statuses, and the others are fetched
+	streaming bool
+	seq       uint64
+	// version increases when the status shown changes, which is told by
+	// its digest
+	version uint64
+	digest  [sha256.Size]byte
 }
 
 func NewExporterInfo(url string) *ExporterInfo {
-	return &ExporterInfo{url: url, ws: nil, mu: new(sync.RWMutex)}
+	return &ExporterInfo{url: url, state: stateConnecting, ws: nil, mu: new(sync.RWMutex), credentials: &Credentials{Mode: authNone}, scheme: "ws"}
 }
 
 func (i *ExporterInfo) connect() {
-	if i.isOnline {
+	i.mu.Lock()
+	if i.agent || i.connected() || time.Now().Before(i.nextDial) {
+		i.mu.Unlock()
 		return
 	}
+	i.state = stateConnecting
+	i.mu.Unlock()
 
-	ws, _, err := dial.Dial("ws://"+i.url+"/ws", http.Header{})
-	if err != nil {
-	  i.ws = nil
-		i.isOnline = false
-		log.Errorf("Dial error for machine %s: %s:", i.url, err)
-	} else {
-		i.mu.Lock()
-		defer i.mu.Unlock()
+	dialer := dial
+	dialer.TLSClientConfig = i.tlsConfig
+	header, err := i.credentials.Header("GET", "/ws")
+	if err == nil {
+		var ws *websocket.Conn
+		var response *http.Response
+		ws, response, err = dialer.Dial(i.scheme+"://"+i.url+"/ws", header)
+		if err == nil {
+			if err = i.start(ws); err == nil {
+				log.Infof("%s is connected", i.url)
+				return
+			}
+		} else if response != nil && response.StatusCode == http.StatusUnauthorized {
+			err = fmt.Errorf("credentials are rejected")
+		}
+	}
+
+	i.mu.Lock()
+	first := i.fail()
+	failures := i.failures
+	retry := time.Until(i.nextDial).Round(time.Second)
+	changed := i.touch()
+	i.mu.Unlock()
+	if changed {
+		i.broadcast()
+	}
 
-		i.ws = ws
-		i.isOnline = true
-		log.Infof("%s is connected", i.url)
+	// failures after the first one only tell the exporter is still offline
+	if first {
+		log.Errorf("Connect to machine %s failed, retry in %s: %s", i.url, retry, err)
+	} else {
+		log.Debugf("Connect to machine %s failed %d times, retry in %s: %s", i.url, failures, retry, err)
 	}
 }
 
+// fetch asks an exporter not pushing its statuses for one. The connection is
+// used without the lock held, so that a hung exporter delays only itself
+// until the deadlines pass.
 func (i *ExporterInfo) fetch() error {
-	if !i.isOnline {
+	i.mu.RLock()
+	ws := i.ws
+	online := i.connected()
+	streaming := i.streaming
+	i.mu.RUnlock()
+
+	if !online {
 		return fmt.Errorf("%s is not online", i.url)
 	}
+	if streaming {
+		return nil
+	}
+
+	_ = ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err := ws.WriteMessage(websocket.TextMessage, []byte("fetch"))
+	action := "Write to"
+	var exporter_m []byte
+	if err == nil {
+		_ = ws.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+		_, exporter_m, err = ws.ReadMessage()
+		action = "Read from"
+	}
 
 	i.mu.Lock()
-	defer i.mu.Unlock()
+	// the connection may have been replaced by an agent reconnecting
+	current := i.ws == ws && i.connected()
+	changed := false
+	if current {
+		if err != nil {
+			i.fail()
+		} else {
+			i.seen(string(exporter_m))
+		}
+		changed = i.touch()
+	}
+	i.mu.Unlock()
 
-	err := i.ws.WriteMessage(1, []byte("fetch"))
 	if err != nil {
-		i.isOnline = false
-		_ = i.ws.Close()
-		log.Warnf("Write to exporter machine %s failed: %s", i.url, err)
-		return err
+		_ = ws.Close()
+		if current {
+			log.Warnf("%s exporter machine %s failed: %s", action, i.url, err)
+		}
 	}
-	_, exporter_m, err := i.ws.ReadMessage()
-	if err != nil {
-		i.isOnline = false
-		_ = i.ws.Close()
-		log.Warnf("Read from exporter machine %s failed: %s", i.url, err)
-		return err
+	// browsers are told after the lock is released
+	if changed {
+		i.broadcast()
 	}
-
-	i.status = string(exporter_m)
-
-	return nil
+	return err
 }
 
 var (
@@ -105,6 +189,8 @@ var (
 
 	router = mux.NewRouter()
 
+	hub = NewHub()
+
 	exporterInfos = []*ExporterInfo{}
 )
 
@@ -119,8 +205,62 @@ func clearSession(response http.ResponseWriter) {
 }
 
 func (o *ServerOptions) init() {
-	for _, machine := range o.Machines {
-		exporterInfos = append(exporterInfos, NewExporterInfo(machine))
+	agents := []string{}
+	for _, agent := range o.Agents {
+		agents = append(agents, strings.Split(agent, "->")[0])
+	}
+
+	// --exporter-token applies to machines not listed in --exporter-token-file
+	tokens := map[string]string{}
+	fallback := o.ExporterToken
+	if o.ExporterTokenFile != "" {
+		var err error
+		var fileFallback string
+		if tokens, fileFallback, err = readMachineTokens(o.ExporterTokenFile); err != nil {
+			log.Fatal("exporter token: ", err)
+		}
+		if fileFallback != "" {
+			fallback = fileFallback
+		}
+	}
+
+	for idx, machine := range o.Machines {
+		machine, scheme, tlsConfig, err := o.parseExporter(machine)
+		if err != nil {
+			log.Fatalf("Machine %s: %s", o.Machines[idx], err)
+		}
+		// machines are shown and looked up without the scheme and settings
+		if idx < len(o.Aliases) && o.Aliases[idx] == o.Machines[idx] {
+			o.Aliases[idx] = machine
+		}
+		o.Machines[idx] = machine
+
+		exporterInfo := NewExporterInfo(machine)
+		exporterInfo.agent = stringInSlice(machine, agents)
+		if exporterInfo.agent {
+			// agents are offline until they connect
+			exporterInfo.state = stateOffline
+			exporterInfo.offlineSince = time.Now()
+		}
+		exporterInfo.scheme = scheme
+		exporterInfo.tlsConfig = tlsConfig
+
+		token, ok := tokens[machine]
+		if !ok {
+			token = fallback
+		}
+		credentials, err := NewCredentials(o.ExporterAuth, token)
+		if err != nil {
+			log.Fatalf("Credentials for machine %s: %s", machine, err)
+		}
+		exporterInfo.credentials = credentials
+
+		exporterInfos = append(exporterInfos, exporterInfo)
+		// browsers are shown machines in the order given
+		exporterInfo.mu.Lock()
+		exporterInfo.touch()
+		exporterInfo.mu.Unlock()
+		exporterInfo.broadcast()
 	}
 }
 
@@ -148,6 +288,17 @@ func (o *ServerOptions) fetchAll() {
 	wg.Wait()
 }
 
+// checkAll tells browsers about exporters turning stale.
+func (o *ServerOptions) checkAll() {
+	for _, exporterInfo := range exporterInfos {
+		if exporterInfo.check() {
+			exporterInfo.broadcast()
+		}
+	}
+}
+
+// connectLoop dials exporters not connected. Dials of unreachable exporters
+// may take a while, so exporters are checked by checkLoop apart from them.
 func (o *ServerOptions) connectLoop() {
 	for {
 		o.connectAll()
@@ -155,43 +306,16 @@ func (o *ServerOptions) connectLoop() {
 	}
 }
 
-func (o *ServerOptions) fetchLoop() {
+func (o *ServerOptions) checkLoop() {
 	for {
-		o.fetchAll()
+		o.checkAll()
 		time.Sleep(time.Duration(o.Interval) * time.Millisecond)
 	}
 }
 
-func (o *ServerOptions) webSocketHandler(w http.ResponseWriter, r *http.Request) {
-	// Upgrade initial GET request to a websocket
-	ws, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Fatal(err)
-	}
-	// Make sure we close the connection when the function returns
-	defer ws.Close()
-
+func (o *ServerOptions) fetchLoop() {
 	for {
-		for _, exporterInfo := range exporterInfos {
-			exporterInfo.mu.RLock()
-
-			status := "<p class='ef9'>Server is offline</p>"
-			url := exporterInfo.url
-			if exporterInfo.isOnline {
-				status = exporterInfo.status
-			}
-
-			ws.WriteJSON(struct {
-				Machine string
-				Data    string
-			}{
-				Machine: url,
-				Data:    status,
-			})
-
-			exporterInfo.mu.RUnlock()
-		}
-
+		o.fetchAll()
 		time.Sleep(time.Duration(o.Interval) * time.Millisecond)
 	}
 }
@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// agentMachineHeader carries the name an agent registers under.
+const agentMachineHeader = "X-Mstat-Machine"
+
+// agentHandler accepts exporters connecting with --upstream. The connection
+// is used in the same way as the ones dialed to exporters, so that the
+// server keeps fetching over it and marks the agent offline when it breaks.
+func (o *ServerOptions) agentHandler(w http.ResponseWriter, r *http.Request) {
+	name := r.Header.Get(agentMachineHeader)
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if o.AgentToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(o.AgentToken)) != 1 {
+		log.Warnf("Invalid agent token for machine %s from %s", name, r.RemoteAddr)
+		http.Error(w, "401 unauthorized.", http.StatusUnauthorized)
+		return
+	}
+
+	var exporterInfo *ExporterInfo
+	for _, e := range exporterInfos {
+		if e.agent && e.url == name {
+			exporterInfo = e
+			break
+		}
+	}
+	if exporterInfo == nil {
+		log.Warnf("Unknown agent %s from %s", name, r.RemoteAddr)
+		http.Error(w, "403 unknown agent.", http.StatusForbidden)
+		return
+	}
+
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warnf("Upgrade for agent %s failed: %s", name, err)
+		return
+	}
+
+	if err := exporterInfo.start(ws); err != nil {
+		log.Warnf("Subscribe to agent %s failed: %s", name, err)
+		return
+	}
+	log.Infof("Agent %s is connected from %s", name, r.RemoteAddr)
+}
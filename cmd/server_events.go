@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// eventsHandler sends the updates of /ws as server-sent events, for browsers
+// behind proxies that do not pass WebSocket upgrades through. Each event is
+// the data of a message of /ws, and a comment is sent every
+// clientPingInterval to keep proxies from closing an idle stream.
+func (o *ServerOptions) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "405 method not allowed.", http.StatusMethodNotAllowed)
+		return
+	}
+
+	controller := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// nginx buffers responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		log.Warnf("Events for client %s are not supported: %s", r.RemoteAddr, err)
+		return
+	}
+
+	client := hub.register(r.RemoteAddr, hub.resume(r))
+	defer hub.unregister(client)
+
+	ticker := time.NewTicker(clientPingInterval)
+	defer ticker.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case data, ok := <-client.send:
+			if !ok {
+				return
+			}
+			_ = controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+			_, err = fmt.Fprintf(w, "data: %s\n\n", data)
+		case <-ticker.C:
+			_ = controller.SetWriteDeadline(time.Now().Add(writeTimeout))
+			_, err = fmt.Fprint(w, ": ping\n\n")
+		}
+		if err == nil {
+			err = controller.Flush()
+		}
+		if err != nil {
+			log.Debugf("Write to client %s failed: %s", r.RemoteAddr, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package cmd
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// clientQueueSize is how many updates a browser may fall behind by, on
+	// top of the statuses of all machines sent when it connects, before it
+	// is dropped.
+	clientQueueSize = 64
+	// clientPingInterval is how often browsers are pinged, and
+	// clientPongTimeout how long they have to answer.
+	clientPingInterval = 30 * time.Second
+	clientPongTimeout  = 2 * clientPingInterval
+)
+
+// MachineUpdate is the status of a machine sent to browsers. Version
+// increases with each change of the status of the machine.
+type MachineUpdate struct {
+	Machine string
+	Data    string
+	Version uint64
+}
+
+// SessionMessage is sent first to a browser. A browser reconnecting with the
+// session and the versions of machines it has, as in
+// /ws?session=<session>&versions={"host:9200":12}, is sent only machines
+// changed since. Versions are only known within the session, which changes
+// when the server restarts.
+type SessionMessage struct {
+	Session string
+}
+
+// Hub fans updates of machines out to browsers over /ws and /events. Each
+// browser has a queue of its own, so that a slow one is dropped rather than
+// holding the others up. The last update of each machine is kept for
+// browsers connecting later, so that no exporter is waited for while holding
+// the hub.
+type Hub struct {
+	clients map[*hubClient]struct{}
+	session string
+	// latest is the last update of each machine, and machines the order
+	// they were first broadcast in
+	latest   map[string]MachineUpdate
+	machines []string
+	mu       *sync.Mutex
+}
+
+type hubClient struct {
+	remote string
+	send   chan []byte
+	// sent is the version of each machine last queued, which is only
+	// accessed while holding the hub
+	sent map[string]uint64
+}
+
+func NewHub() *Hub {
+	session := make([]byte, 16)
+	if _, err := rand.Read(session); err != nil {
+		log.Fatal("Session: ", err)
+	}
+	return &Hub{
+		clients: map[*hubClient]struct{}{},
+		session: hex.EncodeToString(session),
+		latest:  map[string]MachineUpdate{},
+		mu:      new(sync.Mutex),
+	}
+}
+
+// register adds a browser with the session and the statuses of machines
+// changed since the versions it has queued. They are taken while holding
+// the hub, so that no update in between is missed.
+func (h *Hub) register(remote string, versions map[string]uint64) *hubClient {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	client := &hubClient{
+		remote: remote,
+		send:   make(chan []byte, clientQueueSize+len(h.machines)+1),
+		sent:   map[string]uint64{},
+	}
+	data, err := json.Marshal(SessionMessage{Session: h.session})
+	if err != nil {
+		log.Warn("Marshal session is failed: ", err)
+	} else {
+		client.send <- data
+	}
+
+	for _, machine := range h.machines {
+		update := h.latest[machine]
+		client.sent[update.Machine] = update.Version
+		if version, ok := versions[update.Machine]; ok && version >= update.Version {
+			continue
+		}
+		data, err := json.Marshal(update)
+		if err != nil {
+			log.Warn("Marshal update is failed: ", err)
+			continue
+		}
+		client.send <- data
+	}
+	h.clients[client] = struct{}{}
+	return client
+}
+
+// resume returns the versions of machines a browser reconnecting with the
+// session of the hub has. Versions of another session are of another run of
+// the server, so the browser is sent every machine.
+func (h *Hub) resume(r *http.Request) map[string]uint64 {
+	versions := map[string]uint64{}
+	query := r.URL.Query()
+	session := query.Get("session")
+	if session == "" {
+		return versions
+	}
+	if session != h.session {
+		log.Debugf("Client %s resumes an expired session", r.RemoteAddr)
+		return versions
+	}
+	if err := json.Unmarshal([]byte(query.Get("versions")), &versions); err != nil {
+		log.Debugf("Client %s resumes with invalid versions: %s", r.RemoteAddr, err)
+		return map[string]uint64{}
+	}
+	return versions
+}
+
+// unregister stops sending to the browser. It may be called more than once.
+func (h *Hub) unregister(client *hubClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client]; ok {
+		delete(h.clients, client)
+		close(client.send)
+	}
+}
+
+// Broadcast keeps the update for browsers connecting later, and queues it for
+// every browser that has not got it yet, dropping the ones whose queue is
+// full. Updates older than the one kept, which were taken before it but
+// broadcast after it, are not sent.
+func (h *Hub) Broadcast(update MachineUpdate) {
+	data, err := json.Marshal(update)
+	if err != nil {
+		log.Warn("Marshal update is failed: ", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	latest, ok := h.latest[update.Machine]
+	if ok && latest.Version >= update.Version {
+		return
+	}
+	if !ok {
+		h.machines = append(h.machines, update.Machine)
+	}
+	h.latest[update.Machine] = update
+
+	for client := range h.clients {
+		if version, ok := client.sent[update.Machine]; ok && version >= update.Version {
+			continue
+		}
+		select {
+		case client.send <- data:
+			client.sent[update.Machine] = update.Version
+		default:
+			log.Warnf("Client %s is too slow, dropping it", client.remote)
+			delete(h.clients, client)
+			close(client.send)
+		}
+	}
+}
+
+// writeLoop writes queued updates and pings until the queue is closed or a
+// write fails. Closing the connection makes readLoop return as well.
+func (c *hubClient) writeLoop(ws *websocket.Conn) {
+	ticker := time.NewTicker(clientPingInterval)
+	defer func() {
+		ticker.Stop()
+		_ = ws.Close()
+	}()
+
+	for {
+		select {
+		case data, ok := <-c.send:
+			_ = ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if !ok {
+				_ = ws.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := ws.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Debugf("Write to client %s failed: %s", c.remote, err)
+				return
+			}
+		case <-ticker.C:
+			if err := ws.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeTimeout)); err != nil {
+				log.Debugf("Ping to client %s failed: %s", c.remote, err)
+				return
+			}
+		}
+	}
+}
+
+// readLoop reads until the browser is gone or misses pongs. Browsers send
+// nothing else, but pongs are only handled while reading.
+func (c *hubClient) readLoop(ws *websocket.Conn) {
+	ws.SetReadLimit(512)
+	_ = ws.SetReadDeadline(time.Now().Add(clientPongTimeout))
+	ws.SetPongHandler(func(string) error {
+		return ws.SetReadDeadline(time.Now().Add(clientPongTimeout))
+	})
+
+	for {
+		if _, _, err := ws.NextReader(); err != nil {
+			return
+		}
+	}
+}
+
+// update is the status of the machine to show.
+func (i *ExporterInfo) update() MachineUpdate {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	return MachineUpdate{Machine: i.url, Data: i.shown(), Version: i.version}
+}
+
+// touch bumps the version if the status shown changed, and tells whether it
+// did. It must be called while holding the lock.
+func (i *ExporterInfo) touch() bool {
+	digest := sha256.Sum256([]byte(i.shown()))
+	if i.version > 0 && digest == i.digest {
+		return false
+	}
+	i.digest = digest
+	i.version++
+	return true
+}
+
+// broadcast sends the status of the machine to browsers.
+func (i *ExporterInfo) broadcast() {
+	hub.Broadcast(i.update())
+}
+
+func (o *ServerOptions) webSocketHandler(w http.ResponseWriter, r *http.Request) {
+	// Upgrade initial GET request to a websocket
+	ws, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warnf("Upgrade for client %s failed: %s", r.RemoteAddr, err)
+		return
+	}
+
+	client := hub.register(r.RemoteAddr, hub.resume(r))
+	defer hub.unregister(client)
+
+	go client.writeLoop(ws)
+	client.readLoop(ws)
+}
@@ -0,0 +1,196 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// queued takes the messages queued for the client without blocking, and
+// tells whether its queue is closed.
+func queued(t *testing.T, client *hubClient) ([]MachineUpdate, bool) {
+	t.Helper()
+
+	updates := []MachineUpdate{}
+	for {
+		select {
+		case data, ok := <-client.send:
+			if !ok {
+				return updates, true
+			}
+			session := SessionMessage{}
+			if err := json.Unmarshal(data, &session); err == nil && session.Session != "" {
+				continue
+			}
+			update := MachineUpdate{}
+			if err := json.Unmarshal(data, &update); err != nil {
+				t.Fatal(err)
+			}
+			updates = append(updates, update)
+		default:
+			return updates, false
+		}
+	}
+}
+
+func TestHubRegister(t *testing.T) {
+	h := NewHub()
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a1", Version: 1})
+	h.Broadcast(MachineUpdate{Machine: "b:9200", Data: "b1", Version: 1})
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a2", Version: 2})
+
+	tests := []struct {
+		name     string
+		versions map[string]uint64
+		want     []MachineUpdate
+	}{
+		{
+			name: "new",
+			want: []MachineUpdate{
+				{Machine: "a:9200", Data: "a2", Version: 2},
+				{Machine: "b:9200", Data: "b1", Version: 1},
+			},
+		},
+		{
+			name:     "resumed",
+			versions: map[string]uint64{"a:9200": 2, "b:9200": 0},
+			want:     []MachineUpdate{{Machine: "b:9200", Data: "b1", Version: 1}},
+		},
+		{
+			name:     "up to date",
+			versions: map[string]uint64{"a:9200": 2, "b:9200": 1},
+			want:     []MachineUpdate{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := h.register("browser", tt.versions)
+			defer h.unregister(client)
+
+			first := <-client.send
+			session := SessionMessage{}
+			if err := json.Unmarshal(first, &session); err != nil || session.Session != h.session {
+				t.Fatalf("first message = %s, want the session", first)
+			}
+			got, closed := queued(t, client)
+			if closed {
+				t.Fatal("queue is closed")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("queued %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHubBroadcast(t *testing.T) {
+	h := NewHub()
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a1", Version: 1})
+
+	resumed := h.register("resumed", map[string]uint64{"a:9200": 1})
+	fresh := h.register("fresh", nil)
+	<-resumed.send
+	<-fresh.send
+	if got, _ := queued(t, fresh); len(got) != 1 {
+		t.Fatalf("fresh client is queued %+v, want a1", got)
+	}
+
+	// an update taken before the one kept is not sent
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a3", Version: 3})
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a2", Version: 2})
+	h.Broadcast(MachineUpdate{Machine: "b:9200", Data: "b1", Version: 1})
+
+	want := []MachineUpdate{
+		{Machine: "a:9200", Data: "a3", Version: 3},
+		{Machine: "b:9200", Data: "b1", Version: 1},
+	}
+	for _, client := range []*hubClient{resumed, fresh} {
+		if got, _ := queued(t, client); !reflect.DeepEqual(got, want) {
+			t.Errorf("client %s is queued %+v, want %+v", client.remote, got, want)
+		}
+	}
+	if latest := h.latest["a:9200"]; latest.Version != 3 {
+		t.Errorf("latest = %+v, want version 3", latest)
+	}
+
+	// unregister closes the queue once
+	h.unregister(fresh)
+	h.unregister(fresh)
+	if _, closed := queued(t, fresh); !closed {
+		t.Error("queue of the unregistered client is open")
+	}
+	h.Broadcast(MachineUpdate{Machine: "a:9200", Data: "a4", Version: 4})
+	if got, _ := queued(t, resumed); len(got) != 1 {
+		t.Errorf("client is queued %+v, want a4", got)
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	h := NewHub()
+	slow := h.register("slow", nil)
+	fast := h.register("fast", nil)
+
+	// the slow client reads nothing, and the queue holds the session and
+	// clientQueueSize updates
+	for version := uint64(1); version <= clientQueueSize+1; version++ {
+		h.Broadcast(MachineUpdate{Machine: "a:9200", Data: fmt.Sprint(version), Version: version})
+		if _, closed := queued(t, fast); closed {
+			t.Fatalf("fast client is dropped at version %d", version)
+		}
+	}
+
+	if _, ok := h.clients[slow]; ok {
+		t.Fatal("slow client is not dropped")
+	}
+	<-slow.send
+	got, closed := queued(t, slow)
+	if !closed || len(got) != clientQueueSize {
+		t.Errorf("slow client is queued %d updates and closed %v, want %d and closed", len(got), closed, clientQueueSize)
+	}
+	if _, ok := h.clients[fast]; !ok {
+		t.Error("fast client is dropped")
+	}
+
+	// the handler unregisters the dropped client as well
+	h.unregister(slow)
+}
+
+func TestHubResume(t *testing.T) {
+	h := NewHub()
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  map[string]uint64
+	}{
+		{name: "new", query: url.Values{}, want: map[string]uint64{}},
+		{
+			name:  "resumed",
+			query: url.Values{"session": {h.session}, "versions": {`{"a:9200":12,"b:9200":3}`}},
+			want:  map[string]uint64{"a:9200": 12, "b:9200": 3},
+		},
+		{
+			name:  "expired",
+			query: url.Values{"session": {"0123"}, "versions": {`{"a:9200":12}`}},
+			want:  map[string]uint64{},
+		},
+		{
+			name:  "invalid versions",
+			query: url.Values{"session": {h.session}, "versions": {`{"a:9200":-1}`}},
+			want:  map[string]uint64{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/ws?"+tt.query.Encode(), nil)
+			if got := h.resume(request); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resume() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -100,9 +100,25 @@ func init() {
 	insecureServerCmd.Flags().IntVar(&insecureServerOptions.Interval, "interval", 1000,
 		"refresh interval in milliseconds")
 	insecureServerCmd.Flags().StringSliceVar(&insecureServerOptions.Machines, "machine", []string{},
-		"comma seperated exporter machines with port (ex: 'host:9200' or 'host:9200->alias' with alias) ")
+		"comma seperated exporter machines with port (ex: 'host:9200', 'host:9200->alias' with alias or 'wss://host:9200?server-name=name' with TLS) ")
 	insecureServerCmd.Flags().StringSliceVar(&insecureServerOptions.Collapses, "collapse", []string{},
 		"comma seperated exporter machines with port (ex: 'host:9200') to collapse default")
+	insecureServerCmd.Flags().StringSliceVar(&insecureServerOptions.Agents, "agent", []string{},
+		"comma seperated names of exporters connecting with --upstream (ex: 'name' or 'name->alias' with alias)")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.AgentToken, "agent-token", "",
+		"token exporters connecting with --upstream should present")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterAuth, "exporter-auth", authNone,
+		"authentication exporters require, one of none, bearer and hmac")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterToken, "exporter-token", "",
+		"token to present to exporters or sign requests with")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterTokenFile, "exporter-token-file", "",
+		"file of lines of 'host:9200 token' for each machine, where a token alone is for the others")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterCA, "exporter-ca", "",
+		"CA bundle to verify exporters of wss:// with (default system CAs)")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterCert, "exporter-cert", "",
+		"client certificate to present to exporters of wss://")
+	insecureServerCmd.Flags().StringVar(&insecureServerOptions.ExporterKey, "exporter-key", "",
+		"key of --exporter-cert")
 }
 
 // server main method
@@ -125,6 +141,9 @@ func (o *InsecureOptions) Run(cmd *cobra.Command, args []string) {
 		log.Panic("https-key and https-crt should be given")
 	}
 
+	// agents are listed like machines but connect by themselves
+	o.Machines = append(o.Machines, o.Agents...)
+
 	// parse machine
 	for idx, machine := range o.Machines {
 		parsed := strings.Split(machine, "->")
@@ -153,10 +172,13 @@ func (o *InsecureOptions) Run(cmd *cobra.Command, args []string) {
 	o.init()
 	o.connectAll()
 	go o.connectLoop()
+	go o.checkLoop()
 	go o.fetchLoop()
 
 	router.HandleFunc("/", o.dashboardHandler)
 	router.HandleFunc("/ws", o.webSocketHandler)
+	router.HandleFunc("/events", o.eventsHandler)
+	router.HandleFunc("/agent", o.agentHandler)
 
 	http.Handle("/web/", http.StripPrefix("/web/", http.FileServer(http.Dir("./web"))))
 	http.Handle("/", router)
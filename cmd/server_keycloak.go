@@ -254,9 +254,25 @@ func init() {
 	keycloakServerCmd.Flags().IntVar(&keycloakOptions.Interval, "interval", 1000,
 		"refresh interval in milliseconds")
 	keycloakServerCmd.Flags().StringSliceVar(&keycloakOptions.Machines, "machine", []string{},
-		"comma seperated exporter machines with port (ex: 'host:9200' or 'host:9200->alias' with alias) ")
+		"comma seperated exporter machines with port (ex: 'host:9200', 'host:9200->alias' with alias or 'wss://host:9200?server-name=name' with TLS) ")
 	keycloakServerCmd.Flags().StringSliceVar(&keycloakOptions.Collapses, "collapse", []string{},
 		"comma seperated exporter machines with port (ex: 'host:9200') to collapse default")
+	keycloakServerCmd.Flags().StringSliceVar(&keycloakOptions.Agents, "agent", []string{},
+		"comma seperated names of exporters connecting with --upstream (ex: 'name' or 'name->alias' with alias)")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.AgentToken, "agent-token", "",
+		"token exporters connecting with --upstream should present")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterAuth, "exporter-auth", authNone,
+		"authentication exporters require, one of none, bearer and hmac")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterToken, "exporter-token", "",
+		"token to present to exporters or sign requests with")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterTokenFile, "exporter-token-file", "",
+		"file of lines of 'host:9200 token' for each machine, where a token alone is for the others")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterCA, "exporter-ca", "",
+		"CA bundle to verify exporters of wss:// with (default system CAs)")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterCert, "exporter-cert", "",
+		"client certificate to present to exporters of wss://")
+	keycloakServerCmd.Flags().StringVar(&keycloakOptions.ExporterKey, "exporter-key", "",
+		"key of --exporter-cert")
 	keycloakServerCmd.Flags().StringVar(&keycloakOptions.KeycloakServer, "keycloak-server", "",
 		"keycloak server")
 	keycloakServerCmd.Flags().StringVar(&keycloakOptions.KeycloakRealm, "keycloak-realm", "master",
@@ -287,6 +303,9 @@ func (o *KeycloakOptions) Run(cmd *cobra.Command, args []string) {
 		log.Panic("https-key and https-crt should be given")
 	}
 
+	// agents are listed like machines but connect by themselves
+	o.Machines = append(o.Machines, o.Agents...)
+
 	// parse machine
 	for idx, machine := range o.Machines {
 		parsed := strings.Split(machine, "->")
@@ -315,10 +334,13 @@ func (o *KeycloakOptions) Run(cmd *cobra.Command, args []string) {
 	o.init()
 	o.connectAll()
 	go o.connectLoop()
+	go o.checkLoop()
 	go o.fetchLoop()
 
 	router.HandleFunc("/", o.indexPageHandler)
 	router.HandleFunc("/ws", o.webSocketHandler)
+	router.HandleFunc("/events", o.eventsHandler)
+	router.HandleFunc("/agent", o.agentHandler)
 	router.HandleFunc("/dashboard", o.dashboardHandler)
 	router.HandleFunc("/login", o.loginHandler).Methods("POST")
 	router.HandleFunc("/logout", o.logoutHandler).Methods("POST")
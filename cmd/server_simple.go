@@ -99,6 +99,19 @@ func (o *SimpleOptions) indexPageHandler(response http.ResponseWriter, request *
 	})
 }
 
+// requireUser rejects requests of anyone but the users logged in, whom the
+// dashboard is served to.
+func (o *SimpleOptions) requireUser(next http.HandlerFunc) http.HandlerFunc {
+	return func(response http.ResponseWriter, request *http.Request) {
+		if userName := getUserName(request); !stringInSlice(userName, o.Users) {
+			log.Warnf("Unauthenticated request to %s from %s", request.URL.Path, request.RemoteAddr)
+			http.Error(response, "401 unauthorized.", http.StatusUnauthorized)
+			return
+		}
+		next(response, request)
+	}
+}
+
 func (o *SimpleOptions) dashboardHandler(response http.ResponseWriter, request *http.Request) {
 	userName := getUserName(request)
 	if stringInSlice(userName, o.Users) {
@@ -173,9 +186,25 @@ func init() {
 	simpleServerCmd.Flags().IntVar(&serverOptions.Interval, "interval", 1000,
 		"refresh interval in milliseconds")
 	simpleServerCmd.Flags().StringSliceVar(&serverOptions.Machines, "machine", []string{},
-		"comma seperated exporter machines with port (ex: 'host:9200' or 'host:9200->alias' with alias) ")
+		"comma seperated exporter machines with port (ex: 'host:9200', 'host:9200->alias' with alias or 'wss://host:9200?server-name=name' with TLS) ")
 	simpleServerCmd.Flags().StringSliceVar(&serverOptions.Collapses, "collapse", []string{},
 		"comma seperated exporter machines with port (ex: 'host:9200') to collapse default")
+	simpleServerCmd.Flags().StringSliceVar(&serverOptions.Agents, "agent", []string{},
+		"comma seperated names of exporters connecting with --upstream (ex: 'name' or 'name->alias' with alias)")
+	simpleServerCmd.Flags().StringVar(&serverOptions.AgentToken, "agent-token", "",
+		"token exporters connecting with --upstream should present")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterAuth, "exporter-auth", authNone,
+		"authentication exporters require, one of none, bearer and hmac")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterToken, "exporter-token", "",
+		"token to present to exporters or sign requests with")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterTokenFile, "exporter-token-file", "",
+		"file of lines of 'host:9200 token' for each machine, where a token alone is for the others")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterCA, "exporter-ca", "",
+		"CA bundle to verify exporters of wss:// with (default system CAs)")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterCert, "exporter-cert", "",
+		"client certificate to present to exporters of wss://")
+	simpleServerCmd.Flags().StringVar(&serverOptions.ExporterKey, "exporter-key", "",
+		"key of --exporter-cert")
 	simpleServerCmd.Flags().StringSliceVar(&serverOptions.Users, "user", []string{},
 		"comma seperated allowed user list")
 	simpleServerCmd.Flags().StringSliceVar(&serverOptions.Pwds, "pwd", []string{},
@@ -202,6 +231,9 @@ func (o *SimpleOptions) Run(cmd *cobra.Command, args []string) {
 		log.Panic("https-key and https-crt should be given")
 	}
 
+	// agents are listed like machines but connect by themselves
+	o.Machines = append(o.Machines, o.Agents...)
+
 	// parse machine
 	for idx, machine := range o.Machines {
 		parsed := strings.Split(machine, "->")
@@ -230,10 +262,13 @@ func (o *SimpleOptions) Run(cmd *cobra.Command, args []string) {
 	o.init()
 	o.connectAll()
 	go o.connectLoop()
+	go o.checkLoop()
 	go o.fetchLoop()
 
 	router.HandleFunc("/", o.indexPageHandler)
 	router.HandleFunc("/ws", o.webSocketHandler)
+	router.HandleFunc("/events", o.requireUser(o.eventsHandler))
+	router.HandleFunc("/agent", o.agentHandler)
 	router.HandleFunc("/dashboard", o.dashboardHandler)
 	router.HandleFunc("/login", o.loginHandler).Methods("POST")
 	router.HandleFunc("/logout", o.logoutHandler).Methods("POST")
@@ -0,0 +1,52 @@
+package cmd
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// sessionCookie is the cookie of the user logged in.
+func sessionCookie(t *testing.T, userName string) *http.Cookie {
+	t.Helper()
+
+	response := httptest.NewRecorder()
+	setSessionWithName(userName, response)
+	cookies := response.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("setSessionWithName() set %d cookies", len(cookies))
+	}
+	return cookies[0]
+}
+
+func TestSimpleRequireUser(t *testing.T) {
+	o := &SimpleOptions{Users: []string{"user1", "user2"}}
+	handler := o.requireUser(func(response http.ResponseWriter, request *http.Request) {
+		response.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   int
+	}{
+		{name: "logged in", cookie: sessionCookie(t, "user2"), want: http.StatusOK},
+		{name: "no session", cookie: nil, want: http.StatusUnauthorized},
+		{name: "other user", cookie: sessionCookie(t, "user3"), want: http.StatusUnauthorized},
+		{name: "forged session", cookie: &http.Cookie{Name: "session", Value: "user1"}, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/events", nil)
+			if tt.cookie != nil {
+				request.AddCookie(tt.cookie)
+			}
+			response := httptest.NewRecorder()
+			handler(response, request)
+			if response.Code != tt.want {
+				t.Errorf("GET /events = %d, want %d", response.Code, tt.want)
+			}
+		})
+	}
+}
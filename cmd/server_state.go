@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+	"html"
+	"math/rand"
+	"time"
+)
+
+// ExporterState is the state of the connection to an exporter.
+//
+//	connecting -> online <-> stale
+//	     ^           |         |
+//	     |           v         |
+//	     +------- offline <----+
+//
+// An exporter is stale when it is connected but no status arrived for
+// staleTimeout, and offline when the connection is lost or failed. Offline
+// exporters are dialed again after a backoff of their own.
+type ExporterState string
+
+const (
+	stateConnecting ExporterState = "connecting"
+	stateOnline     ExporterState = "online"
+	stateStale      ExporterState = "stale"
+	stateOffline    ExporterState = "offline"
+)
+
+const (
+	// staleTimeout is how long a connected exporter may send no status.
+	staleTimeout = heartbeatTimeout
+	// minExporterBackoff and maxExporterBackoff bound the time between
+	// dials of an offline exporter, which doubles with each failure.
+	minExporterBackoff = time.Second
+	maxExporterBackoff = 5 * time.Minute
+)
+
+// connected tells whether statuses can be taken from the connection. It
+// must be called while holding the lock.
+func (i *ExporterInfo) connected() bool {
+	return i.state == stateOnline || i.state == stateStale
+}
+
+// seen records a status taken from the exporter. It must be called while
+// holding the lock.
+func (i *ExporterInfo) seen(status string) {
+	if i.state == stateStale {
+		log.Infof("Exporter machine %s is updated again", i.url)
+	}
+	i.status = status
+	i.lastSeen = time.Now()
+	i.state = stateOnline
+}
+
+// fail takes the exporter offline and schedules the next dial, with jitter
+// so that exporters lost together are not dialed together again. It tells
+// whether the failure is the first one since the exporter was online, which
+// is the one worth logging. It must be called while holding the lock.
+func (i *ExporterInfo) fail() bool {
+	if i.failures == 0 {
+		i.offlineSince = time.Now()
+	}
+	i.state = stateOffline
+	i.failures++
+
+	backoff := minExporterBackoff
+	for n := 1; n < i.failures && backoff < maxExporterBackoff; n++ {
+		backoff *= 2
+	}
+	if backoff > maxExporterBackoff {
+		backoff = maxExporterBackoff
+	}
+	backoff += time.Duration(rand.Int63n(int64(backoff) / 5))
+	i.nextDial = time.Now().Add(backoff)
+
+	return i.failures == 1
+}
+
+// check takes the exporter stale if no status arrived for staleTimeout, and
+// tells whether the status shown changed.
+func (i *ExporterInfo) check() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// exporters may take a while to send the first status
+	if i.state == stateOnline && time.Since(i.lastSeen) > staleTimeout && time.Since(i.connectedAt) > staleTimeout {
+		log.Warnf("No status from exporter machine %s for %s", i.url, staleTimeout)
+		i.state = stateStale
+	}
+	return i.touch()
+}
+
+// age is the time since t, which dashboards count up in its largest unit,
+// e.g. 3h. Its text is the time itself, so that the status shown does not
+// change as the time goes by and is not sent to browsers again.
+func age(t time.Time) string {
+	return fmt.Sprintf("<time class='age' datetime='%s'>%s</time>",
+		t.UTC().Format(time.RFC3339), html.EscapeString(t.Format(dateFormat)))
+}
+
+// shown is the status of the machine to show. It must be called while
+// holding the lock.
+func (i *ExporterInfo) shown() string {
+	switch i.state {
+	case stateOnline:
+		return i.status
+	case stateStale:
+		if i.lastSeen.IsZero() {
+			return "<p class='ef3'>No update yet</p>"
+		}
+		return fmt.Sprintf("<p class='ef3'>No update for %s</p>", age(i.lastSeen)) + i.status
+	case stateConnecting:
+		// dials of offline exporters are not shown
+		if i.failures == 0 {
+			return "<p class='ef8'>Connecting…</p>"
+		}
+	}
+
+	lastSeen := "never"
+	if !i.lastSeen.IsZero() {
+		lastSeen = html.EscapeString(i.lastSeen.Format(dateFormat))
+	}
+	return fmt.Sprintf("<p class='ef9'>Offline for %s, last seen %s</p>", age(i.offlineSince), lastSeen)
+}
@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// subscribe asks the exporter to push its statuses. Exporters predating
+// subscriptions answer it like a fetch with the status itself, in which case
+// they are fetched at the interval as before.
+func subscribe(ws *websocket.Conn) (bool, StreamMessage, error) {
+	_ = ws.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err := ws.WriteMessage(websocket.TextMessage, []byte("subscribe")); err != nil {
+		return false, StreamMessage{}, err
+	}
+
+	_ = ws.SetReadDeadline(time.Now().Add(writeTimeout))
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return false, StreamMessage{}, err
+	}
+	_ = ws.SetReadDeadline(time.Time{})
+
+	message := StreamMessage{}
+	if err := json.Unmarshal(data, &message); err != nil || message.Type == "" {
+		return false, StreamMessage{Type: messageSnapshot, HTML: string(data)}, nil
+	}
+	return true, message, nil
+}
+
+// start takes the connection to the exporter into use, replacing the
+// previous one of an agent reconnecting before the server noticed.
+func (i *ExporterInfo) start(ws *websocket.Conn) error {
+	streaming, message, err := subscribe(ws)
+	if err != nil {
+		_ = ws.Close()
+		return err
+	}
+
+	i.mu.Lock()
+	if i.ws != nil && i.ws != ws {
+		_ = i.ws.Close()
+	}
+	i.ws = ws
+	i.streaming = streaming
+	i.connectedAt = time.Now()
+	if i.failures > 1 {
+		log.Infof("Exporter machine %s is back after %d failures", i.url, i.failures)
+	}
+	i.failures = 0
+	i.state = stateOnline
+	if message.Type == messageSnapshot {
+		i.seen(message.HTML)
+		i.seq = message.Seq
+	}
+	changed := i.touch()
+	i.mu.Unlock()
+	if changed {
+		i.broadcast()
+	}
+
+	if streaming {
+		go i.receive(ws)
+	}
+	return nil
+}
+
+// receive takes statuses pushed by the exporter until the connection breaks
+// or no message arrives for heartbeatTimeout.
+func (i *ExporterInfo) receive(ws *websocket.Conn) {
+	for {
+		_ = ws.SetReadDeadline(time.Now().Add(heartbeatTimeout))
+		message := StreamMessage{}
+		if err := ws.ReadJSON(&message); err != nil {
+			i.mu.Lock()
+			current := i.ws == ws
+			if current {
+				i.fail()
+				i.touch()
+			}
+			i.mu.Unlock()
+			_ = ws.Close()
+
+			if current {
+				log.Warnf("Read from exporter machine %s failed: %s", i.url, err)
+				i.broadcast()
+			}
+			return
+		}
+
+		if message.Type != messageSnapshot {
+			continue
+		}
+		i.mu.Lock()
+		changed := false
+		if i.ws == ws {
+			i.seen(message.HTML)
+			i.seq = message.Seq
+			changed = i.touch()
+		}
+		i.mu.Unlock()
+		if changed {
+			i.broadcast()
+		}
+	}
+}
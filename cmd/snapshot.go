@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"time"
+)
+
+// Snapshot is the status of a machine at a point in time. It is served as
+// JSON by /api/v1/snapshot and rendered as ANSI text for the dashboard.
+// Seq is given by the store it is published to, and it is not modified after.
+type Snapshot struct {
+	Seq     uint64        `json:"seq"`
+	Host    string        `json:"host"`
+	Time    time.Time     `json:"time"`
+	CPU     *CPUStat      `json:"cpu"`
+	Memory  *MemoryStat   `json:"memory"`
+	Disks   []DiskStat    `json:"disks"`
+	Network []NetworkStat `json:"network"`
+	DiskIO  []DiskIOStat  `json:"disk_io"`
+	GPUs    []GPUStat     `json:"gpus"`
+
+	TopCPU    []ProcessStat `json:"top_cpu"`
+	TopMemory []ProcessStat `json:"top_memory"`
+	Users     []UserStat    `json:"users"`
+
+	Collectors []CollectorStatus `json:"collectors"`
+}
+
+// GPUUtilization is the average utilization of all GPUs.
+func (s *Snapshot) GPUUtilization() float64 {
+	if len(s.GPUs) == 0 {
+		return 0
+	}
+	total := 0
+	for _, gpu := range s.GPUs {
+		total += gpu.Utilization
+	}
+	return float64(total) / float64(len(s.GPUs))
+}
+
+// FailingCollectors returns collectors whose last run failed.
+func (s *Snapshot) FailingCollectors() []CollectorStatus {
+	failing := []CollectorStatus{}
+	for _, status := range s.Collectors {
+		if status.Failing() {
+			failing = append(failing, status)
+		}
+	}
+	return failing
+}
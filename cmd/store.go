@@ -0,0 +1,78 @@
+package cmd
+
+import (
+	"context"
+	"sync"
+)
+
+// Frame is a published snapshot with its renderings. It is shared by every
+// reader and must not be modified.
+type Frame struct {
+	Seq      uint64
+	Snapshot *Snapshot
+	// Data is the ANSI rendering, and HTML is the one for the dashboard.
+	Data []byte
+	HTML []byte
+}
+
+// Store holds the latest frame. Readers take it with Latest, or wait for a
+// newer one with Next instead of polling.
+type Store struct {
+	latest *Frame
+	// changed is closed and replaced when a frame is published
+	changed chan struct{}
+	mu      *sync.RWMutex
+}
+
+func NewStore() *Store {
+	return &Store{
+		changed: make(chan struct{}),
+		mu:      new(sync.RWMutex),
+	}
+}
+
+// Publish numbers the snapshot following the latest one and wakes up
+// readers waiting for it. The snapshot must not be modified after.
+func (s *Store) Publish(snapshot *Snapshot, data, html []byte) *Frame {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seq := uint64(1)
+	if s.latest != nil {
+		seq = s.latest.Seq + 1
+	}
+	snapshot.Seq = seq
+	s.latest = &Frame{Seq: seq, Snapshot: snapshot, Data: data, HTML: html}
+
+	close(s.changed)
+	s.changed = make(chan struct{})
+	return s.latest
+}
+
+// Latest returns the latest frame, which is nil before the first one.
+func (s *Store) Latest() *Frame {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.latest
+}
+
+// Next waits for a frame newer than seq and returns the latest one, so that
+// slow readers skip frames they missed rather than falling behind. It
+// returns at once if the latest frame is already newer.
+func (s *Store) Next(ctx context.Context, seq uint64) (*Frame, error) {
+	for {
+		s.mu.RLock()
+		latest, changed := s.latest, s.changed
+		s.mu.RUnlock()
+
+		if latest != nil && latest.Seq > seq {
+			return latest, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-changed:
+		}
+	}
+}
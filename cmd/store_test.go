@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStorePublish(t *testing.T) {
+	s := NewStore()
+	if frame := s.Latest(); frame != nil {
+		t.Fatalf("Latest() = %+v before any frame", frame)
+	}
+
+	for seq := uint64(1); seq <= 3; seq++ {
+		snapshot := &Snapshot{}
+		frame := s.Publish(snapshot, []byte("data"), []byte("html"))
+		if frame.Seq != seq || snapshot.Seq != seq {
+			t.Errorf("Publish() numbered %d and %d, want %d", frame.Seq, snapshot.Seq, seq)
+		}
+		if latest := s.Latest(); latest != frame {
+			t.Errorf("Latest() = %+v, want %+v", latest, frame)
+		}
+	}
+}
+
+func TestStoreNextNewer(t *testing.T) {
+	s := NewStore()
+	s.Publish(&Snapshot{}, nil, nil)
+	want := s.Publish(&Snapshot{}, nil, nil)
+
+	// readers behind skip to the latest frame without waiting
+	frame, err := s.Next(context.Background(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame != want {
+		t.Errorf("Next(0) = frame %d, want %d", frame.Seq, want.Seq)
+	}
+}
+
+func TestStoreNextCancel(t *testing.T) {
+	s := NewStore()
+	s.Publish(&Snapshot{}, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := s.Next(ctx, 1)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("Next() returned %v before a newer frame", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Next() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Next() did not return after the context is canceled")
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := s.Next(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Next() = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestStoreConcurrent is meant to be run with -race.
+func TestStoreConcurrent(t *testing.T) {
+	const (
+		readers = 8
+		frames  = 200
+	)
+	s := NewStore()
+
+	wg := new(sync.WaitGroup)
+	for n := 0; n < readers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			seq := uint64(0)
+			for seq < frames {
+				frame, err := s.Next(ctx, seq)
+				if err != nil {
+					t.Errorf("Next(%d): %s", seq, err)
+					return
+				}
+				if frame.Seq <= seq {
+					t.Errorf("Next(%d) = frame %d", seq, frame.Seq)
+					return
+				}
+				if frame.Snapshot.Seq != frame.Seq || string(frame.Data) != "data" {
+					t.Errorf("frame %d is inconsistent: %+v", frame.Seq, frame)
+					return
+				}
+				seq = frame.Seq
+			}
+		}()
+	}
+
+	for n := 0; n < frames; n++ {
+		s.Publish(&Snapshot{}, []byte("data"), []byte("html"))
+		if latest := s.Latest(); latest == nil {
+			t.Fatal("Latest() = nil after a frame")
+		}
+	}
+	wg.Wait()
+
+	if latest := s.Latest(); latest.Seq != frames {
+		t.Errorf("Latest() = frame %d, want %d", latest.Seq, frames)
+	}
+}
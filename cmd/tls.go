@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readCertPool reads PEM certificates of a CA bundle.
+func readCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("%s: no certificate found", path)
+	}
+	return pool, nil
+}
+
+// exporterTLSConfig verifies clients against the CA bundle if one is given,
+// so that only servers holding a certificate it signed are answered.
+func exporterTLSConfig(clientCA string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if clientCA != "" {
+		pool, err := readCertPool(clientCA)
+		if err != nil {
+			return nil, err
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return config, nil
+}
+
+// upstreamTLSConfig verifies the upstream server against the CA bundle if one
+// is given instead of the system roots, and presents the client certificate
+// if one is given. It is nil when neither is given.
+func upstreamTLSConfig(ca, cert, key string) (*tls.Config, error) {
+	if ca == "" && cert == "" && key == "" {
+		return nil, nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if ca != "" {
+		pool, err := readCertPool(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = pool
+	}
+	if cert != "" || key != "" {
+		certificate, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	return config, nil
+}
+
+// exporterSettings are the settings a machine of wss may have in its query.
+var exporterSettings = []string{"server-name", "ca", "insecure-skip-verify"}
+
+// parseExporter splits a machine into the name it is shown by and the scheme
+// and TLS settings to dial it with. A machine is either 'host:9200' or a URL
+// of ws or wss with TLS settings of its own in the query, e.g.
+// 'wss://host:9200?server-name=exporter.lab&ca=/path/to/ca.pem'. Settings
+// not given in the query are the ones of the server options.
+func (o *ServerOptions) parseExporter(machine string) (string, string, *tls.Config, error) {
+	if !strings.Contains(machine, "://") {
+		return machine, "ws", nil, nil
+	}
+
+	u, err := url.Parse(machine)
+	if err != nil {
+		return "", "", nil, err
+	}
+	if u.Host == "" {
+		return "", "", nil, fmt.Errorf("no host")
+	}
+	query := u.Query()
+	switch u.Scheme {
+	case "ws":
+		if len(query) > 0 {
+			return "", "", nil, fmt.Errorf("settings of ws are not supported")
+		}
+		return u.Host, u.Scheme, nil, nil
+	case "wss":
+	default:
+		return "", "", nil, fmt.Errorf("unknown scheme %s", u.Scheme)
+	}
+	// misspelled settings would otherwise be ignored silently
+	for key := range query {
+		if !stringInSlice(key, exporterSettings) {
+			return "", "", nil, fmt.Errorf("unknown setting %s", key)
+		}
+	}
+
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: query.Get("server-name"),
+	}
+
+	ca := o.ExporterCA
+	if value := query.Get("ca"); value != "" {
+		ca = value
+	}
+	if ca != "" {
+		if config.RootCAs, err = readCertPool(ca); err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	if o.ExporterCert != "" || o.ExporterKey != "" {
+		cert, err := tls.LoadX509KeyPair(o.ExporterCert, o.ExporterKey)
+		if err != nil {
+			return "", "", nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if value := query.Get("insecure-skip-verify"); value != "" {
+		if config.InsecureSkipVerify, err = strconv.ParseBool(value); err != nil {
+			return "", "", nil, fmt.Errorf("invalid insecure-skip-verify %s", value)
+		}
+		if config.InsecureSkipVerify {
+			log.Warnf("Certificate of machine %s is not verified", u.Host)
+		}
+	}
+
+	return u.Host, u.Scheme, config, nil
+}
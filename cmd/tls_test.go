@@ -0,0 +1,166 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTestCert writes a self-signed CA certificate and its key, and returns
+// their paths.
+func writeTestCert(t *testing.T) (string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "machine-status test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	if err := os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, keyPath
+}
+
+func TestParseExporter(t *testing.T) {
+	ca, _ := writeTestCert(t)
+
+	tests := []struct {
+		name               string
+		machine            string
+		host               string
+		scheme             string
+		serverName         string
+		rootCAs            bool
+		insecureSkipVerify bool
+		wantErr            bool
+	}{
+		{name: "plain", machine: "host:9200", host: "host:9200", scheme: "ws"},
+		{name: "ws", machine: "ws://host:9200", host: "host:9200", scheme: "ws"},
+		{name: "wss", machine: "wss://host:9200", host: "host:9200", scheme: "wss"},
+		{name: "server name", machine: "wss://10.0.0.1:9200?server-name=exporter.lab", host: "10.0.0.1:9200", scheme: "wss", serverName: "exporter.lab"},
+		{name: "ca", machine: "wss://host:9200?ca=" + ca, host: "host:9200", scheme: "wss", rootCAs: true},
+		{name: "insecure", machine: "wss://host:9200?insecure-skip-verify=true", host: "host:9200", scheme: "wss", insecureSkipVerify: true},
+		{name: "secure", machine: "wss://host:9200?insecure-skip-verify=false", host: "host:9200", scheme: "wss"},
+		{name: "invalid insecure", machine: "wss://host:9200?insecure-skip-verify=maybe", wantErr: true},
+		{name: "unknown setting", machine: "wss://host:9200?servername=exporter.lab", wantErr: true},
+		{name: "settings of ws", machine: "ws://host:9200?ca=" + ca, wantErr: true},
+		{name: "missing ca", machine: "wss://host:9200?ca=" + filepath.Join(t.TempDir(), "missing.pem"), wantErr: true},
+		{name: "unknown scheme", machine: "https://host:9200", wantErr: true},
+		{name: "no host", machine: "wss://?server-name=exporter.lab", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := &ServerOptions{}
+			host, scheme, config, err := o.parseExporter(tt.machine)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseExporter(%q) error = %v, want error %v", tt.machine, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if host != tt.host || scheme != tt.scheme {
+				t.Errorf("parseExporter(%q) = %s, %s, want %s, %s", tt.machine, host, scheme, tt.host, tt.scheme)
+			}
+			if scheme == "ws" {
+				if config != nil {
+					t.Errorf("parseExporter(%q) has a TLS config for ws", tt.machine)
+				}
+				return
+			}
+			if config.ServerName != tt.serverName {
+				t.Errorf("ServerName = %q, want %q", config.ServerName, tt.serverName)
+			}
+			if (config.RootCAs != nil) != tt.rootCAs {
+				t.Errorf("RootCAs = %v, want set %v", config.RootCAs, tt.rootCAs)
+			}
+			if config.InsecureSkipVerify != tt.insecureSkipVerify {
+				t.Errorf("InsecureSkipVerify = %v, want %v", config.InsecureSkipVerify, tt.insecureSkipVerify)
+			}
+			if config.MinVersion != tls.VersionTLS12 {
+				t.Errorf("MinVersion = %x, want TLS 1.2", config.MinVersion)
+			}
+		})
+	}
+}
+
+func TestParseExporterServerOptions(t *testing.T) {
+	cert, key := writeTestCert(t)
+	o := &ServerOptions{ExporterCA: cert, ExporterCert: cert, ExporterKey: key}
+
+	_, _, config, err := o.parseExporter("wss://host:9200")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.RootCAs == nil {
+		t.Error("--exporter-ca is not used")
+	}
+	if len(config.Certificates) != 1 {
+		t.Errorf("%d certificates are presented, want --exporter-cert", len(config.Certificates))
+	}
+
+	o.ExporterKey = ""
+	if _, _, _, err := o.parseExporter("wss://host:9200"); err == nil {
+		t.Error("parseExporter() succeeded with --exporter-cert without --exporter-key")
+	}
+}
+
+func TestExporterTLSConfig(t *testing.T) {
+	config, err := exporterTLSConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.NoClientCert || config.ClientCAs != nil {
+		t.Errorf("client certificates are required without a client CA")
+	}
+
+	ca, key := writeTestCert(t)
+	config, err = exporterTLSConfig(ca)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.ClientAuth != tls.RequireAndVerifyClientCert || config.ClientCAs == nil {
+		t.Errorf("client certificates are not required with a client CA")
+	}
+
+	// a key holds no certificate
+	if _, err := exporterTLSConfig(key); err == nil {
+		t.Error("exporterTLSConfig() succeeded with no certificate in the CA bundle")
+	}
+	if _, err := exporterTLSConfig(filepath.Join(t.TempDir(), "missing.pem")); err == nil {
+		t.Error("exporterTLSConfig() succeeded with a missing CA bundle")
+	}
+}
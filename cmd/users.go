@@ -0,0 +1,173 @@
+package cmd
+
+import (
+	"bufio"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	anonymousUser = "Anonymous"
+
+	// passwdCheckInterval limits checking the passwd and group files for
+	// changes, as users are looked up for every process
+	passwdCheckInterval = 5 * time.Second
+)
+
+// idFile maps IDs to names of a file in the format of passwd(5) or group(5),
+// which is reloaded when it changes.
+type idFile struct {
+	path      string
+	names     map[string]string
+	modTime   time.Time
+	size      int64
+	checkTime time.Time
+}
+
+func newIDFile(path string) *idFile {
+	return &idFile{path: path, names: map[string]string{}}
+}
+
+func (f *idFile) lookup(id string) (string, bool) {
+	if time.Since(f.checkTime) >= passwdCheckInterval {
+		f.checkTime = time.Now()
+		f.reload()
+	}
+	name, ok := f.names[id]
+	return name, ok
+}
+
+// reload reads the file if it is modified since the last read.
+func (f *idFile) reload() {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		if len(f.names) > 0 {
+			log.Warnf("Unable to read %s: %s", f.path, err)
+		}
+		f.names = map[string]string{}
+		f.modTime = time.Time{}
+		return
+	}
+	if info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return
+	}
+
+	names, err := readIDNames(f.path)
+	if err != nil {
+		log.Warnf("Unable to read %s: %s", f.path, err)
+		return
+	}
+	log.Debugf("Read %d names from %s", len(names), f.path)
+	f.names = names
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+}
+
+// UserResolver resolves UIDs to user names and GIDs to group names. They are
+// read from the passwd and group files under the root, which are reloaded
+// when they change. The system is asked as well when the root is /, so that
+// users of NSS such as LDAP are found. The explicit mapping given by
+// --mapping is used when the UID is unknown.
+type UserResolver struct {
+	system  bool
+	mapping map[string]string
+
+	passwd *idFile
+	group  *idFile
+	mu     *sync.Mutex
+}
+
+// NewUserResolver reads users of the root and parses space separated
+// 'uid:name' pairs of the mapping.
+func NewUserResolver(root, mapping string) *UserResolver {
+	r := &UserResolver{
+		system:  filepath.Clean(root) == "/",
+		mapping: map[string]string{},
+		passwd:  newIDFile(filepath.Join(root, "etc", "passwd")),
+		group:   newIDFile(filepath.Join(root, "etc", "group")),
+		mu:      new(sync.Mutex),
+	}
+	for _, pair := range strings.Fields(mapping) {
+		parsed := strings.SplitN(pair, ":", 2)
+		if len(parsed) != 2 {
+			log.Warnf("Invalid mapping %s is ignored", pair)
+			continue
+		}
+		r.mapping[parsed[0]] = parsed[1]
+		log.Infof("UID mapping: %s -> %s", parsed[0], parsed[1])
+	}
+	return r
+}
+
+func (r *UserResolver) Lookup(uid string) string {
+	if name, ok := r.lookup(r.passwd, uid); ok {
+		return name
+	}
+	if r.system {
+		if u, err := user.LookupId(uid); err == nil {
+			return u.Username
+		}
+	}
+	if name, ok := r.mapping[uid]; ok {
+		return name
+	}
+	return anonymousUser
+}
+
+// LookupGroup resolves the GID to the group name, or the GID itself if the
+// group is unknown.
+func (r *UserResolver) LookupGroup(gid string) string {
+	if name, ok := r.lookup(r.group, gid); ok {
+		return name
+	}
+	if r.system {
+		if g, err := user.LookupGroupId(gid); err == nil {
+			return g.Name
+		}
+	}
+	return gid
+}
+
+func (r *UserResolver) lookup(f *idFile, id string) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return f.lookup(id)
+}
+
+// readIDNames maps IDs to names of the file in the format of passwd(5) or
+// group(5), which both have the ID in the third field.
+func readIDNames(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// name:password:UID:GID:GECOS:directory:shell of passwd and
+		// name:password:GID:members of group
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || fields[0] == "" {
+			continue
+		}
+		// the first entry wins like getpwuid(3) and getgrgid(3)
+		if _, ok := names[fields[2]]; !ok {
+			names[fields[2]] = fields[0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeEtc(t *testing.T, root, name, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "etc", name), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserResolver(t *testing.T) {
+	root := t.TempDir()
+	writeEtc(t, root, "passwd", `# comment
+root:x:0:0:root:/root:/bin/bash
+alice:x:1000:1000:Alice:/home/alice:/bin/bash
+alias:x:1000:1000::/home/alias:/bin/sh
+:x:1001:1001::/:/bin/false
+`)
+	writeEtc(t, root, "group", `root:x:0:
+research:x:1000:alice,bob
+staff:x:50:
+`)
+	r := NewUserResolver(root, "1002:bob invalid")
+
+	for uid, want := range map[string]string{
+		"0":    "root",
+		"1000": "alice",
+		"1001": anonymousUser,
+		"1002": "bob",
+		"1003": anonymousUser,
+	} {
+		if got := r.Lookup(uid); got != want {
+			t.Errorf("Lookup(%s) = %s, want %s", uid, got, want)
+		}
+	}
+	for gid, want := range map[string]string{
+		"0":    "root",
+		"1000": "research",
+		"50":   "staff",
+		"1002": "1002",
+	} {
+		if got := r.LookupGroup(gid); got != want {
+			t.Errorf("LookupGroup(%s) = %s, want %s", gid, got, want)
+		}
+	}
+}
+
+func TestUserResolverReload(t *testing.T) {
+	root := t.TempDir()
+	writeEtc(t, root, "passwd", "alice:x:1000:1000::/home/alice:/bin/bash\n")
+	writeEtc(t, root, "group", "research:x:1000:\n")
+	r := NewUserResolver(root, "")
+
+	if got := r.Lookup("1000"); got != "alice" {
+		t.Fatalf("Lookup(1000) = %s, want alice", got)
+	}
+	if got := r.LookupGroup("1000"); got != "research" {
+		t.Fatalf("LookupGroup(1000) = %s, want research", got)
+	}
+
+	writeEtc(t, root, "passwd", "carolyn:x:1000:1000::/home/carolyn:/bin/bash\n")
+	writeEtc(t, root, "group", "vision:x:1000:\n")
+	// the files are not checked again until the interval passes
+	if got := r.Lookup("1000"); got != "alice" {
+		t.Errorf("Lookup(1000) = %s before the check interval, want alice", got)
+	}
+	r.passwd.checkTime = time.Time{}
+	r.group.checkTime = time.Time{}
+	if got := r.Lookup("1000"); got != "carolyn" {
+		t.Errorf("Lookup(1000) = %s after the change, want carolyn", got)
+	}
+	if got := r.LookupGroup("1000"); got != "vision" {
+		t.Errorf("LookupGroup(1000) = %s after the change, want vision", got)
+	}
+
+	if err := os.Remove(filepath.Join(root, "etc", "group")); err != nil {
+		t.Fatal(err)
+	}
+	r.group.checkTime = time.Time{}
+	if got := r.LookupGroup("1000"); got != "1000" {
+		t.Errorf("LookupGroup(1000) = %s after the removal, want 1000", got)
+	}
+}
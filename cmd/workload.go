@@ -0,0 +1,188 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Workload is what a process runs in, as told by its cgroup. Kubernetes pods
+// are named only if the pod log directory of kubelet is readable, and Docker
+// containers only if the Docker socket is.
+type Workload struct {
+	Runtime       string            `json:"runtime,omitempty"`
+	ContainerID   string            `json:"container_id,omitempty"`
+	ContainerName string            `json:"container_name,omitempty"`
+	Image         string            `json:"image,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	PodUID        string            `json:"pod_uid,omitempty"`
+	PodName       string            `json:"pod_name,omitempty"`
+	PodNamespace  string            `json:"pod_namespace,omitempty"`
+	Unit          string            `json:"unit,omitempty"`
+}
+
+// String is a short name of the workload.
+// e.g. default/train-0, jupyter, docker:0123456789ab, ssh.service
+func (w *Workload) String() string {
+	switch {
+	case w.PodName != "":
+		return w.PodNamespace + "/" + w.PodName
+	case w.PodUID != "":
+		return "pod:" + shortID(w.PodUID, 8)
+	case w.ContainerName != "":
+		return w.ContainerName
+	case w.ContainerID != "":
+		runtime := w.Runtime
+		if runtime == "" {
+			runtime = "container"
+		}
+		return runtime + ":" + shortID(w.ContainerID, 12)
+	}
+	return w.Unit
+}
+
+func shortID(id string, length int) string {
+	if len(id) > length {
+		return id[:length]
+	}
+	return id
+}
+
+var (
+	// kubepods-besteffort-pod<uid>.slice with systemd and pod<uid> with
+	// cgroupfs, where the systemd driver replaces - of the UID with _
+	cgroupPod = regexp.MustCompile(`pod([0-9a-f]{8}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{4}[-_][0-9a-f]{12})(\.slice)?$`)
+	// docker-<id>.scope with systemd and <id> with cgroupfs
+	cgroupContainer = regexp.MustCompile(`^(?:(docker|cri-containerd|crio|libpod)-)?([0-9a-f]{64})(?:\.scope)?$`)
+	cgroupUnit      = regexp.MustCompile(`\.(service|scope)$`)
+
+	cgroupRuntimes = map[string]string{
+		"docker":         "docker",
+		"cri-containerd": "containerd",
+		"crio":           "cri-o",
+		"libpod":         "podman",
+	}
+)
+
+// parseCgroup finds the workload in the content of /proc/[pid]/cgroup. It
+// returns nil for processes outside of containers and units, such as kernel
+// threads.
+func parseCgroup(data string) *Workload {
+	w := &Workload{}
+	for _, line := range strings.Split(data, "\n") {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		segments := strings.Split(parts[2], "/")
+		for idx, segment := range segments {
+			if m := cgroupPod.FindStringSubmatch(segment); m != nil {
+				w.PodUID = strings.ReplaceAll(m[1], "_", "-")
+				continue
+			}
+			if m := cgroupContainer.FindStringSubmatch(segment); m != nil {
+				w.ContainerID = m[2]
+				w.Runtime = cgroupRuntimes[m[1]]
+				if w.Runtime == "" && idx > 0 && segments[idx-1] == "docker" {
+					w.Runtime = "docker"
+				}
+				continue
+			}
+			if cgroupUnit.MatchString(segment) {
+				w.Unit = segment
+			}
+		}
+		if w.ContainerID != "" || w.PodUID != "" {
+			w.Unit = ""
+			return w
+		}
+	}
+	if w.Unit == "" {
+		return nil
+	}
+	return w
+}
+
+type podName struct {
+	namespace string
+	name      string
+}
+
+// WorkloadResolver finds workloads of processes. Names of pods are read from
+// the pod log directory of kubelet, /var/log/pods/<namespace>_<name>_<uid>,
+// and containers are looked up through Docker.
+type WorkloadResolver struct {
+	podLogPath string
+	docker     *DockerClient
+	pods       map[string]podName
+	mu         *sync.Mutex
+}
+
+// NewWorkloadResolver returns a resolver. Pods are not named if podLogPath is
+// empty, and containers are not named if docker is nil.
+func NewWorkloadResolver(podLogPath string, docker *DockerClient) *WorkloadResolver {
+	return &WorkloadResolver{
+		podLogPath: podLogPath,
+		docker:     docker,
+		pods:       map[string]podName{},
+		mu:         new(sync.Mutex),
+	}
+}
+
+// Lookup returns the workload of the process, or nil if it is not in any.
+func (r *WorkloadResolver) Lookup(ctx context.Context, procPath string, pid int) *Workload {
+	data, err := os.ReadFile(filepath.Join(procPath, strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return nil
+	}
+	w := parseCgroup(string(data))
+	if w == nil {
+		return nil
+	}
+	if w.PodUID != "" {
+		if pod, ok := r.podName(w.PodUID); ok {
+			w.PodNamespace = pod.namespace
+			w.PodName = pod.name
+		}
+	}
+	if w.ContainerID != "" && r.docker != nil && (w.Runtime == "docker" || w.Runtime == "") {
+		r.docker.describe(ctx, w)
+	}
+	return w
+}
+
+func (r *WorkloadResolver) podName(uid string) (podName, bool) {
+	if r.podLogPath == "" {
+		return podName{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if pod, ok := r.pods[uid]; ok {
+		return pod, true
+	}
+
+	// the pod is new, or the cache holds removed pods
+	entries, err := os.ReadDir(r.podLogPath)
+	if err != nil {
+		log.Debugf("Unable to read pod logs: %s", err)
+		return podName{}, false
+	}
+	r.pods = map[string]podName{}
+	for _, entry := range entries {
+		parts := strings.Split(entry.Name(), "_")
+		if len(parts) != 3 {
+			continue
+		}
+		r.pods[parts[2]] = podName{namespace: parts[0], name: parts[1]}
+	}
+
+	pod, ok := r.pods[uid]
+	return pod, ok
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCgroup(t *testing.T) {
+	const id = "4f1c2b7e9a0d3c5b6e8f7a9b0c1d2e3f4a5b6c7d8e9f0a1b2c3d4e5f6a7b8c9d"
+	const uid = "0f4e5d6c-1a2b-3c4d-5e6f-7a8b9c0d1e2f"
+
+	tests := []struct {
+		name string
+		data string
+		want *Workload
+	}{
+		{
+			name: "cgroup v2 docker scope",
+			data: "0::/system.slice/docker-" + id + ".scope\n",
+			want: &Workload{Runtime: "docker", ContainerID: id},
+		},
+		{
+			name: "cgroup v2 containerd scope",
+			data: "0::/system.slice/cri-containerd-" + id + ".scope\n",
+			want: &Workload{Runtime: "containerd", ContainerID: id},
+		},
+		{
+			name: "cgroup v1 docker cgroupfs",
+			data: "12:pids:/docker/" + id + "\n11:memory:/docker/" + id + "\n1:name=systemd:/docker/" + id + "\n",
+			want: &Workload{Runtime: "docker", ContainerID: id},
+		},
+		{
+			name: "cgroup v2 kubepods systemd",
+			data: "0::/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod" +
+				"0f4e5d6c_1a2b_3c4d_5e6f_7a8b9c0d1e2f.slice/cri-containerd-" + id + ".scope\n",
+			want: &Workload{Runtime: "containerd", ContainerID: id, PodUID: uid},
+		},
+		{
+			name: "cgroup v1 kubepods cgroupfs",
+			data: "11:memory:/kubepods/burstable/pod" + uid + "/" + id + "\n",
+			want: &Workload{ContainerID: id, PodUID: uid},
+		},
+		{
+			name: "cgroup v2 systemd service",
+			data: "0::/system.slice/ssh.service\n",
+			want: &Workload{Unit: "ssh.service"},
+		},
+		{
+			name: "cgroup v1 user session",
+			data: "12:pids:/user.slice/user-1000.slice/session-3.scope\n1:name=systemd:/user.slice/user-1000.slice/session-3.scope\n",
+			want: &Workload{Unit: "session-3.scope"},
+		},
+		{
+			name: "cgroup v2 root",
+			data: "0::/\n",
+			want: nil,
+		},
+		{
+			name: "empty",
+			data: "",
+			want: nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseCgroup(tt.data); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseCgroup(%q) = %+v, want %+v", tt.data, got, tt.want)
+			}
+		})
+	}
+}